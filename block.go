@@ -5,8 +5,69 @@ import (
 )
 
 // Block represents an element of the template.
+//
+// Every block has a Source field, which the scanner sets to the template
+// text the block was read from, delimiters included.
 type Block interface {
-	write(*bytes.Buffer) error
+	write(*bytes.Buffer, *Config) error
+}
+
+// trimMarkers returns whether b was opened with "<%-", trimming the
+// indentation before it, and whether it was closed with "-%>", trimming the
+// newline after it.
+func trimMarkers(b Block) (left, right bool) {
+	switch b := b.(type) {
+	case *CodeBlock:
+		return b.TrimLeft, b.TrimRight
+	case *CommentBlock:
+		return b.TrimLeft, b.TrimRight
+	case *HeaderBlock:
+		return b.TrimLeft, b.TrimRight
+	case *ParameterBlock:
+		return b.TrimLeft, b.TrimRight
+	case *PrintBlock:
+		return b.TrimLeft, b.TrimRight
+	case *RawPrintBlock:
+		return b.TrimLeft, b.TrimRight
+	case *TranslateBlock:
+		return b.TrimLeft, b.TrimRight
+	case *DirectiveBlock:
+		return b.TrimLeft, b.TrimRight
+	case *ComponentBlock:
+		return b.TrimLeft, b.TrimRight
+	case *EndBlock:
+		return b.TrimLeft, b.TrimRight
+	}
+	return false, false
+}
+
+// blockSource returns the Source field of b.
+func blockSource(b Block) *string {
+	switch b := b.(type) {
+	case *TextBlock:
+		return &b.Source
+	case *CodeBlock:
+		return &b.Source
+	case *CommentBlock:
+		return &b.Source
+	case *HeaderBlock:
+		return &b.Source
+	case *ParameterBlock:
+		return &b.Source
+	case *PrintBlock:
+		return &b.Source
+	case *RawPrintBlock:
+		return &b.Source
+	case *TranslateBlock:
+		return &b.Source
+	case *DirectiveBlock:
+		return &b.Source
+	case *ComponentBlock:
+		return &b.Source
+	case *EndBlock:
+		return &b.Source
+	}
+	return new(string)
 }
 
 // isTextBlock returns true if the block is a text block.
@@ -14,3 +75,32 @@ func isTextBlock(b Block) bool {
 	_, ok := b.(*TextBlock)
 	return ok
 }
+
+// blockPos returns the position of b.
+func blockPos(b Block) Pos {
+	switch b := b.(type) {
+	case *TextBlock:
+		return b.Pos
+	case *CodeBlock:
+		return b.Pos
+	case *CommentBlock:
+		return b.Pos
+	case *HeaderBlock:
+		return b.Pos
+	case *ParameterBlock:
+		return b.Pos
+	case *PrintBlock:
+		return b.Pos
+	case *RawPrintBlock:
+		return b.Pos
+	case *TranslateBlock:
+		return b.Pos
+	case *DirectiveBlock:
+		return b.Pos
+	case *ComponentBlock:
+		return b.Pos
+	case *EndBlock:
+		return b.Pos
+	}
+	return Pos{}
+}
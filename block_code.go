@@ -7,12 +7,15 @@ import (
 
 // CodeBlock represents a Go code block that is printed as-is to the template.
 type CodeBlock struct {
-	Pos     Pos
-	Content string
+	Pos       Pos
+	Content   string
+	TrimLeft  bool
+	TrimRight bool
+	Source    string
 }
 
-func (b *CodeBlock) write(buf *bytes.Buffer) error {
-	b.Pos.write(buf)
+func (b *CodeBlock) write(buf *bytes.Buffer, config *Config) error {
+	b.Pos.write(buf, config)
 	fmt.Fprintln(buf, b.Content)
 	return nil
 }
@@ -6,10 +6,13 @@ import (
 
 // CommentBlock represents a block of text which is discarded
 type CommentBlock struct {
-	Pos     Pos
-	Content string
+	Pos       Pos
+	Content   string
+	TrimLeft  bool
+	TrimRight bool
+	Source    string
 }
 
-func (b *CommentBlock) write(buf *bytes.Buffer) error {
+func (b *CommentBlock) write(buf *bytes.Buffer, config *Config) error {
 	return nil
 }
@@ -0,0 +1,162 @@
+package egon
+
+import (
+	"bytes"
+	"fmt"
+	"go/token"
+)
+
+// ComponentBlock represents a block that renders another template, e.g.
+// <%@ component Card title="Hi" %>. Name is the name of the template, which
+// is found in the folder of the template calling it, or in an imported
+// package if it is qualified, like layouts.Card. Args are passed to the
+// parameters of the same name; parameters without an argument get their
+// zero value.
+//
+// The blocks up to the matching <%@ end %> are the children of the
+// component. They are passed to its children parameter, of type
+// func(io.Writer) error. A block ending in "/", like <%@ component Icon
+// name="star" / %>, has no children and no end.
+type ComponentBlock struct {
+	Pos         Pos
+	Content     string
+	Name        string
+	Args        []NamedArg
+	SelfClosing bool
+	TrimLeft    bool
+	TrimRight   bool
+	Source      string
+
+	target *componentFunc // set by resolveComponents
+}
+
+// componentFunc is the template func a component block calls, with its
+// parameters after the writer.
+type componentFunc struct {
+	name   string
+	params []componentParam
+}
+
+// componentParam is a parameter of the template func of a component. typ
+// is its type as written in the template calling the component, and
+// imports are the import specs the type needs.
+type componentParam struct {
+	name, typ string
+	imports   []string
+}
+
+// EndBlock represents a block that closes the last open component block,
+// <%@ end %>.
+type EndBlock struct {
+	Pos       Pos
+	TrimLeft  bool
+	TrimRight bool
+	Source    string
+
+	open *ComponentBlock // the component it closes, set by resolveComponents
+}
+
+func (b *ComponentBlock) write(buf *bytes.Buffer, config *Config) error {
+	b.Pos.write(buf, config)
+	fmt.Fprintf(buf, "if err := %s(w", b.target.name)
+	for _, param := range b.target.params {
+		if param.name == "children" && !b.SelfClosing {
+			buf.WriteString(", func(w io.Writer) error {\n")
+			return nil
+		}
+		buf.WriteString(", " + b.arg(param))
+	}
+	buf.WriteString("); err != nil {\nreturn err\n}\n")
+	return nil
+}
+
+// arg returns the expression passed to param.
+func (b *ComponentBlock) arg(param componentParam) string {
+	for _, arg := range b.Args {
+		if arg.Name == param.name {
+			return printExpr(arg.Expr)
+		}
+	}
+	if param.name == "children" {
+		return "nil"
+	}
+	return "*new(" + param.typ + ")"
+}
+
+// imports returns the import specs of the types of the zero values b
+// passes.
+func (b *ComponentBlock) imports() []string {
+	var imports []string
+	for _, param := range b.target.params {
+		if param.name != "children" && !b.hasArg(param.name) {
+			imports = append(imports, param.imports...)
+		}
+	}
+	return imports
+}
+
+// hasArg returns whether b has an argument for the parameter name.
+func (b *ComponentBlock) hasArg(name string) bool {
+	for _, arg := range b.Args {
+		if arg.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// hasChildren returns whether the children of b are passed to its template
+// func.
+func (b *ComponentBlock) hasChildren() bool {
+	if b.SelfClosing || b.target == nil {
+		return false
+	}
+	for _, param := range b.target.params {
+		if param.name == "children" {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *EndBlock) write(buf *bytes.Buffer, config *Config) error {
+	if b.open == nil || !b.open.hasChildren() {
+		return nil
+	}
+	b.Pos.write(buf, config)
+	buf.WriteString("return nil\n}")
+	after := false
+	for _, param := range b.open.target.params {
+		if after {
+			buf.WriteString(", " + b.open.arg(param))
+		}
+		after = after || param.name == "children"
+	}
+	buf.WriteString("); err != nil {\nreturn err\n}\n")
+	return nil
+}
+
+// parseComponent reads the template name, the name=expr arguments and the
+// closing "/" of a component directive.
+func parseComponent(content string) (name string, args []NamedArg, selfClosing bool, err error) {
+	toks := exprTokens(content)
+	if len(toks) < 2 || toks[0].lit != "component" || toks[1].tok != token.IDENT {
+		return "", nil, false, ErrDirectiveFormat
+	}
+	name, toks = toks[1].lit, toks[2:]
+	if len(toks) >= 2 && toks[0].tok == token.PERIOD && toks[1].tok == token.IDENT {
+		name, toks = name+"."+toks[1].lit, toks[2:]
+	}
+	if n := len(toks); n > 0 && toks[n-1].tok == token.QUO {
+		selfClosing, toks = true, toks[:n-1]
+	}
+	if args, err = parseNamedArgs(content, toks); err != nil {
+		return "", nil, false, ErrDirectiveFormat
+	}
+	for _, arg := range args {
+		if arg.Name == "children" {
+			return "", nil, false, ErrDirectiveFormat
+		}
+	}
+	return name, args, selfClosing, nil
+}
@@ -0,0 +1,79 @@
+package egon
+
+import (
+	"bytes"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"strings"
+)
+
+// DirectiveBlock represents a block that instructs the generator, e.g.
+// <%@ filter upper strings.ToUpper %>. Name is the first word of the
+// block, and Args are the words following it.
+//
+// The "filter name func" directive declares a filter for the pipes of print
+// blocks, and the "filters [name] path" directive declares the exported
+// funcs of the package at the quoted import path as filters, named with a
+// lower case first letter. The "children" directive renders the children
+// passed to a component template, if there are any.
+type DirectiveBlock struct {
+	Pos       Pos
+	Content   string
+	Name      string
+	Args      []string
+	TrimLeft  bool
+	TrimRight bool
+	Source    string
+}
+
+func (b *DirectiveBlock) write(buf *bytes.Buffer, config *Config) error {
+	if b.Name != "children" {
+		return nil
+	}
+	b.Pos.write(buf, config)
+	buf.WriteString("if children != nil {\n")
+	buf.WriteString("if err := children(w); err != nil {\nreturn err\n}\n")
+	buf.WriteString("}\n")
+	return nil
+}
+
+// parseDirective reads the name and arguments of a directive block, and
+// checks that they are well formed.
+func parseDirective(content string) (string, []string, error) {
+	fields := strings.Fields(content)
+	if len(fields) == 0 {
+		return "", nil, ErrDirectiveFormat
+	}
+	name, args := fields[0], fields[1:]
+
+	switch name {
+	case "filter":
+		if len(args) != 2 || !isFilterName(args[0]) {
+			return "", nil, ErrDirectiveFormat
+		}
+		if _, err := parser.ParseExpr(args[1]); err != nil {
+			return "", nil, ErrDirectiveFormat
+		}
+	case "filters":
+		if len(args) < 1 || len(args) > 2 {
+			return "", nil, ErrDirectiveFormat
+		}
+		if _, err := strconv.Unquote(args[len(args)-1]); err != nil {
+			return "", nil, ErrDirectiveFormat
+		}
+	case "children":
+		if len(args) != 0 {
+			return "", nil, ErrDirectiveFormat
+		}
+	default:
+		return "", nil, ErrDirectiveFormat
+	}
+	return name, args, nil
+}
+
+// isFilterName returns whether s can name a filter: an identifier or a Go
+// keyword.
+func isFilterName(s string) bool {
+	return token.IsIdentifier(s) || token.Lookup(s).IsKeyword()
+}
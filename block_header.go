@@ -7,12 +7,15 @@ import (
 
 // HeaderBlock represents a Go code block that is printed at the top of the template.
 type HeaderBlock struct {
-	Pos     Pos
-	Content string
+	Pos       Pos
+	Content   string
+	TrimLeft  bool
+	TrimRight bool
+	Source    string
 }
 
-func (b *HeaderBlock) write(buf *bytes.Buffer) error {
-	b.Pos.write(buf)
+func (b *HeaderBlock) write(buf *bytes.Buffer, config *Config) error {
+	b.Pos.write(buf, config)
 	fmt.Fprintln(buf, b.Content)
 	return nil
 }
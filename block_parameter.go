@@ -10,10 +10,13 @@ type ParameterBlock struct {
 	Pos       Pos
 	ParamName string
 	ParamType string
+	TrimLeft  bool
+	TrimRight bool
+	Source    string
 }
 
-func (b *ParameterBlock) write(buf *bytes.Buffer) error {
-	b.Pos.write(buf)
+func (b *ParameterBlock) write(buf *bytes.Buffer, config *Config) error {
+	b.Pos.write(buf, config)
 	fmt.Fprintf(buf, "%s %s", b.ParamName, b.ParamType)
 	return nil
 }
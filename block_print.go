@@ -3,27 +3,133 @@ package egon
 import (
 	"bytes"
 	"fmt"
+	"go/scanner"
+	"go/token"
+	"strings"
 )
 
 // PrintBlock represents a block that will HTML escape the contents before outputting
+//
+// Type is an optional format code given before the expression, e.g.
+// <%=d n %>. The codes 'd' (signed integers), 'u' (unsigned integers),
+// 'f' and 'g' (floats), 't' (bool), 'D' (time.Time), 'B' ([]byte),
+// 'S' (fmt.Stringer) and 's' (string) are written without going through
+// fmt, and don't compile for values of other kinds. 'H' writes the safe
+// string types (egon.HTML and friends) as they are. The codes 'n'
+// (numbers), 'M' (locale.Money) and 'L' (time.Time, as a date) format the
+// value by the conventions of the locale in the render context. Any other
+// code is used as a fmt verb. Without a code, the value is written with
+// egon.Print. Precision is the number of decimals for 'f', 'g' and 'n', or
+// -1 for the default, e.g. <%=f.2 price %>.
 type PrintBlock struct {
-	Pos     Pos
-	Content string
-	Type    byte
+	Pos       Pos
+	Content   string
+	Type      byte
+	Precision int
+	TrimLeft  bool
+	TrimRight bool
+	Source    string
+
+	imports []string // imports of the filters Content calls
 }
 
-func (b *PrintBlock) write(buf *bytes.Buffer) error {
-	b.Pos.write(buf)
+func (b *PrintBlock) write(buf *bytes.Buffer, config *Config) error {
+	b.Pos.write(buf, config)
+	content := printExpr(b.Content)
 
 	switch b.Type {
 	case 'd':
-		fmt.Fprintf(buf, `io.WriteString(w, strconv.Itoa(%s))`+"\n", b.Content)
+		fmt.Fprintf(buf, `w.Write(egon.AppendInt(egonScratch.B[:0], %s))`+"\n", content)
+	case 'u':
+		fmt.Fprintf(buf, `w.Write(egon.AppendUint(egonScratch.B[:0], %s))`+"\n", content)
+	case 'f', 'g':
+		precision := b.Precision
+		if precision < 0 && b.Type == 'f' {
+			precision = 6
+		}
+		fmt.Fprintf(buf, `w.Write(egon.AppendFloat(egonScratch.B[:0], %s, '%c', %d))`+"\n", content, b.Type, precision)
+	case 't':
+		fmt.Fprintf(buf, `w.Write(strconv.AppendBool(egonScratch.B[:0], %s))`+"\n", content)
+	case 'D':
+		fmt.Fprintf(buf, `w.Write((%s).AppendFormat(egonScratch.B[:0], "2006-01-02T15:04:05Z07:00"))`+"\n", content)
+	case 'B':
+		fmt.Fprintf(buf, `egon.Escape(w, %s)`+"\n", content)
+	case 'S':
+		fmt.Fprintf(buf, `egon.EscapeString(w, (%s).String())`+"\n", content)
 	case 's':
-		fmt.Fprintf(buf, `io.WriteString(w, html.EscapeString(%s))`+"\n", b.Content)
+		fmt.Fprintf(buf, `egon.EscapeString(w, %s)`+"\n", content)
+	case 'H':
+		fmt.Fprintf(buf, `io.WriteString(w, string(%s))`+"\n", content)
+	case 'n':
+		fmt.Fprintf(buf, `w.Write(egon.AppendNumber(egonLocale, egonScratch.B[:0], %s, %d))`+"\n", content, b.Precision)
+	case 'M':
+		fmt.Fprintf(buf, `egon.EscapeString(w, egonLocale.FormatMoney(%s))`+"\n", content)
+	case 'L':
+		fmt.Fprintf(buf, `w.Write(egonLocale.AppendDate(egonScratch.B[:0], %s))`+"\n", content)
 	case 0:
-		fmt.Fprintf(buf, `io.WriteString(w, html.EscapeString(fmt.Sprintf("%%v", %s)))`+"\n", b.Content)
+		fmt.Fprintf(buf, `egon.Print(w, %s)`+"\n", content)
 	default:
-		fmt.Fprintf(buf, `io.WriteString(w, html.EscapeString(fmt.Sprintf("%%%c", %s)))`+"\n", b.Type, b.Content)
+		fmt.Fprintf(buf, `egon.EscapeString(w, fmt.Sprintf("%%%c", %s))`+"\n", b.Type, content)
 	}
 	return nil
 }
+
+// usesFmt returns true if the generated code formats the value with fmt.
+func (b *PrintBlock) usesFmt() bool {
+	switch b.Type {
+	case 'd', 'u', 'f', 'g', 't', 'D', 'B', 'S', 's', 'H', 'n', 'M', 'L', 0:
+		return false
+	}
+	return true
+}
+
+// usesStrconv returns true if the generated code formats the value with
+// strconv.
+func (b *PrintBlock) usesStrconv() bool {
+	return b.Type == 't'
+}
+
+// usesScratch returns true if the generated code formats the value into
+// the scratch buffer.
+func (b *PrintBlock) usesScratch() bool {
+	switch b.Type {
+	case 'd', 'u', 'f', 'g', 't', 'D', 'n', 'L':
+		return true
+	}
+	return false
+}
+
+// usesLocale returns true if the generated code formats the value with the
+// locale of the render context.
+func (b *PrintBlock) usesLocale() bool {
+	switch b.Type {
+	case 'n', 'M', 'L':
+		return true
+	}
+	return false
+}
+
+// printExpr returns the expression of a print block without its line
+// comments, which would comment out the rest of the generated statement.
+func printExpr(content string) string {
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(content))
+	var s scanner.Scanner
+	s.Init(file, []byte(content), nil, scanner.ScanComments)
+
+	var buf strings.Builder
+	last := 0
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if tok == token.COMMENT && strings.HasPrefix(lit, "//") {
+			offset := file.Offset(pos)
+			buf.WriteString(content[last:offset])
+			last = offset + strings.IndexByte(content[offset:]+"\n", '\n')
+		}
+	}
+	buf.WriteString(content[last:])
+	return buf.String()
+}
@@ -7,13 +7,18 @@ import (
 
 // RawPrintBlock represents a block of the template that is printed out to the writer.
 type RawPrintBlock struct {
-	Pos     Pos
-	Content string
-	Type    byte
+	Pos       Pos
+	Content   string
+	Type      byte
+	TrimLeft  bool
+	TrimRight bool
+	Source    string
+
+	imports []string // imports of the filters Content calls
 }
 
-func (b *RawPrintBlock) write(buf *bytes.Buffer) error {
-	b.Pos.write(buf)
-	fmt.Fprintf(buf, `io.WriteString(w, %s)`+"\n", b.Content)
+func (b *RawPrintBlock) write(buf *bytes.Buffer, config *Config) error {
+	b.Pos.write(buf, config)
+	fmt.Fprintf(buf, `io.WriteString(w, %s)`+"\n", printExpr(b.Content))
 	return nil
 }
@@ -6,37 +6,27 @@ import (
 )
 
 // TextBlock represents a UTF-8 encoded block of text that is written to the writer as-is.
+//
+// Raw is set for the text of a <%raw%>...<%endraw%> region, in which
+// delimiters aren't read as blocks. Trim markers don't trim raw text.
 type TextBlock struct {
 	Pos     Pos
 	Content string
-}
+	Raw     bool
+	Source  string
 
-func stripWhitespace(s string) string {
-	out := make([]byte, 0)
-	seenSpace := false
-	for _, c := range s {
-		switch c {
-		case '\t', '\n', '\v', '\f', '\r':
-			seenSpace = true
-		case ' ':
-			if !seenSpace {
-				out = append(out, byte(c))
-				seenSpace = true
-			}
-		default:
-			out = append(out, byte(c))
-			seenSpace = false
-		}
-	}
-	return string(out)
+	// ident names the package level variable holding the content, if any.
+	ident string
 }
 
-func (b *TextBlock) write(buf *bytes.Buffer) error {
-	if Config.Minify {
-		b.Content = stripWhitespace(b.Content)
+func (b *TextBlock) write(buf *bytes.Buffer, config *Config) error {
+	if len(b.Content) == 0 {
+		return nil
 	}
-	if len(b.Content) > 0 {
-		b.Pos.write(buf)
+	b.Pos.write(buf, config)
+	if b.ident != "" {
+		fmt.Fprintf(buf, "w.Write(%s)\n", b.ident)
+	} else {
 		fmt.Fprintf(buf, `io.WriteString(w, %q)`+"\n", b.Content)
 	}
 	return nil
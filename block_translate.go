@@ -0,0 +1,142 @@
+package egon
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/token"
+	"strconv"
+	"strings"
+)
+
+// TranslateBlock represents a block that writes a translated message, e.g.
+// <%t "Hello, {name}" name=u.Name %>.
+//
+// Message is the message before translation. Its {name} placeholders are
+// replaced by the HTML escaped values of Args after translating, with the
+// Translator found in the render context of the template.
+//
+// Plural is the plural form of the message, if one is given after it, e.g.
+// <%t "{n} item" "{n} items" n=len(items) %>. The form is picked by the
+// value of the first argument.
+type TranslateBlock struct {
+	Pos       Pos
+	Content   string
+	Message   string
+	Plural    string
+	Args      []NamedArg
+	TrimLeft  bool
+	TrimRight bool
+	Source    string
+}
+
+// NamedArg is an argument of a translation or component block, given as
+// name=expr.
+type NamedArg struct {
+	Name string
+	Expr string
+
+	offset int // offset of Expr in the block content
+}
+
+func (b *TranslateBlock) write(buf *bytes.Buffer, config *Config) error {
+	b.Pos.write(buf, config)
+	if b.Plural != "" {
+		fmt.Fprintf(buf, "egon.TranslatePlural(w, egonCtx, %s, %s", strconv.Quote(b.Message), strconv.Quote(b.Plural))
+	} else {
+		fmt.Fprintf(buf, "egon.Translate(w, egonCtx, %s", strconv.Quote(b.Message))
+	}
+	for _, arg := range b.Args {
+		fmt.Fprintf(buf, ", %q, %s", arg.Name, printExpr(arg.Expr))
+	}
+	buf.WriteString(")\n")
+	return nil
+}
+
+// parseTranslation reads the message literal, the plural literal if there
+// is one, and the name=expr arguments of a translation block.
+func parseTranslation(content string) (msg, plural string, args []NamedArg, err error) {
+	toks := exprTokens(content)
+	if len(toks) == 0 || toks[0].tok != token.STRING {
+		return "", "", nil, ErrTranslationFormat
+	}
+	if msg, err = strconv.Unquote(toks[0].lit); err != nil {
+		return "", "", nil, ErrTranslationFormat
+	}
+	first := 1
+	if len(toks) > 1 && toks[1].tok == token.STRING {
+		if plural, err = strconv.Unquote(toks[1].lit); err != nil {
+			return "", "", nil, ErrTranslationFormat
+		}
+		first = 2
+	}
+	if args, err = parseNamedArgs(content, toks[first:]); err != nil {
+		return "", "", nil, ErrTranslationFormat
+	}
+	if plural != "" && len(args) == 0 {
+		return "", "", nil, ErrTranslationFormat
+	}
+	return msg, plural, args, nil
+}
+
+// errNamedArgs is returned by parseNamedArgs for malformed arguments, and
+// replaced by the error of the block type.
+var errNamedArgs = errors.New("malformed arguments")
+
+// parseNamedArgs reads the name=expr arguments of a block from toks, the
+// tokens of content following what precedes the arguments. An argument's
+// expression runs up to the next name=, outside of brackets. Names must be
+// unique.
+func parseNamedArgs(content string, toks []exprToken) ([]NamedArg, error) {
+	var (
+		args  []NamedArg
+		depth int
+	)
+	for i := 0; i < len(toks); i++ {
+		t := toks[i]
+		switch t.tok {
+		case token.ILLEGAL:
+			return nil, errNamedArgs
+		case token.LPAREN, token.LBRACK, token.LBRACE:
+			depth++
+		case token.RPAREN, token.RBRACK, token.RBRACE:
+			depth--
+		}
+		start := depth == 0 && t.tok == token.IDENT && i+1 < len(toks) && toks[i+1].tok == token.ASSIGN
+		if !start {
+			if len(args) == 0 {
+				return nil, errNamedArgs
+			}
+			continue
+		}
+		if len(args) > 0 {
+			last := &args[len(args)-1]
+			last.Expr = strings.TrimSpace(content[last.offset:t.offset])
+		}
+		i++
+		if i+1 == len(toks) {
+			return nil, errNamedArgs
+		}
+		args = append(args, NamedArg{Name: t.lit, offset: toks[i+1].offset})
+	}
+	if len(args) > 0 {
+		last := &args[len(args)-1]
+		last.Expr = strings.TrimSpace(content[last.offset:toks[len(toks)-1].end])
+	}
+
+	seen := map[string]bool{}
+	for _, arg := range args {
+		if arg.Expr == "" || seen[arg.Name] {
+			return nil, errNamedArgs
+		}
+		seen[arg.Name] = true
+	}
+	return args, nil
+}
+
+// isTranslation returns whether next, the text following "t" at the start
+// of a block, is the message of a translation block rather than Go code.
+func isTranslation(next []byte) bool {
+	rest := bytes.TrimLeft(next, " \t\r\n")
+	return len(rest) > 0 && len(rest) < len(next) && (rest[0] == '"' || rest[0] == '`')
+}
@@ -8,7 +8,7 @@ for NAME in $NAMES; do
 	for ARCH in $ARCHS; do
 		for OS in $OSES; do
 			echo $OS $ARCH $NAME
-			docker run --rm -v $(pwd):/go/src/github.com/$PROJECT -w /go/src/github.com/$PROJECT -e GOOS=${OS} -e GOARCH=${ARCH} -e CGO_ENABLED=0 -e GOARM=7 golang:1.10-alpine go build -o build/${NAME}-${OS}-${ARCH} cmd/${NAME}/*.go
+			docker run --rm -v $(pwd):/go/src/github.com/$PROJECT -w /go/src/github.com/$PROJECT -e GOOS=${OS} -e GOARCH=${ARCH} -e CGO_ENABLED=0 -e GOARM=7 golang:1.18-alpine go build -o build/${NAME}-${OS}-${ARCH} ./cmd/${NAME}
 			if [ $? -eq 0 ]; then
 				echo OK
 			fi
@@ -0,0 +1,136 @@
+package egon
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Catalog is the set of messages of the translation blocks in templates,
+// collected by Extract to be handed to translators.
+type Catalog struct {
+	Messages []*CatalogMessage // in the order they were first found
+
+	index map[string]*CatalogMessage
+}
+
+// CatalogMessage is a message of a catalog, with its plural form if it has
+// one, and the positions of the translation blocks it was found in.
+type CatalogMessage struct {
+	ID     string
+	Plural string
+	Refs   []Pos
+
+	pluralRef Pos // the block the plural form was found in
+}
+
+// Extract reads the blocks from s and adds the messages of its translation
+// blocks to c. Messages are identified by their ID; a message used both with
+// and without a plural form gets the plural form, and a message used with
+// two different plural forms is an error.
+func (c *Catalog) Extract(s *Scanner) error {
+	if c.index == nil {
+		c.index = map[string]*CatalogMessage{}
+	}
+	for {
+		pos := s.pos
+		b, err := s.Scan()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return scanError(pos, err)
+		}
+
+		tb, ok := b.(*TranslateBlock)
+		if !ok {
+			continue
+		}
+		m := c.index[tb.Message]
+		if m == nil {
+			m = &CatalogMessage{ID: tb.Message}
+			c.index[tb.Message] = m
+			c.Messages = append(c.Messages, m)
+		}
+		if tb.Plural != "" && m.Plural != "" && tb.Plural != m.Plural {
+			return scanError(tb.Pos, fmt.Errorf("message %q has the plural form %q, and %q at %s", m.ID, tb.Plural, m.Plural, catalogRef(m.pluralRef)))
+		}
+		if tb.Plural != "" && m.Plural == "" {
+			m.Plural, m.pluralRef = tb.Plural, tb.Pos
+		}
+		m.Refs = append(m.Refs, tb.Pos)
+	}
+}
+
+// ExtractFile adds the messages of the template at path, scanned with
+// config, to c.
+func (c *Catalog) ExtractFile(path string, config *Config) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return c.Extract(NewScannerConfig(f, path, config))
+}
+
+// WritePOT writes c as a gettext template, with a "#:" reference comment
+// for every block a message was found in.
+func (c *Catalog) WritePOT(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("msgid \"\"\n")
+	bw.WriteString("msgstr \"\"\n")
+	bw.WriteString("\"Content-Type: text/plain; charset=UTF-8\\n\"\n")
+	for _, m := range c.Messages {
+		bw.WriteString("\n")
+		for _, ref := range m.Refs {
+			fmt.Fprintf(bw, "#: %s\n", catalogRef(ref))
+		}
+		fmt.Fprintf(bw, "msgid %s\n", poQuote(m.ID))
+		if m.Plural != "" {
+			fmt.Fprintf(bw, "msgid_plural %s\n", poQuote(m.Plural))
+			bw.WriteString("msgstr[0] \"\"\n")
+			bw.WriteString("msgstr[1] \"\"\n")
+		} else {
+			bw.WriteString("msgstr \"\"\n")
+		}
+	}
+	return bw.Flush()
+}
+
+// jsonMessage is a catalog message as written by WriteJSON.
+type jsonMessage struct {
+	ID         string   `json:"id"`
+	Plural     string   `json:"plural,omitempty"`
+	References []string `json:"references"`
+}
+
+// WriteJSON writes c as a JSON array of objects with the "id" of a message,
+// its "plural" form if it has one, and its "references", the file:line
+// positions it was found at.
+func (c *Catalog) WriteJSON(w io.Writer) error {
+	out := make([]jsonMessage, len(c.Messages))
+	for i, m := range c.Messages {
+		out[i].ID, out[i].Plural = m.ID, m.Plural
+		for _, ref := range m.Refs {
+			out[i].References = append(out[i].References, catalogRef(ref))
+		}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+// catalogRef returns the file:line reference of pos.
+func catalogRef(pos Pos) string {
+	return fmt.Sprintf("%s:%d", filepath.ToSlash(pos.Path), pos.LineNo)
+}
+
+var poEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`, "\r", `\r`)
+
+// poQuote returns s as a PO string literal.
+func poQuote(s string) string {
+	return `"` + poEscaper.Replace(s) + `"`
+}
@@ -0,0 +1,74 @@
+package egon_test
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	. "github.com/titpetric/egon"
+)
+
+// Ensure that the messages of templates are collected with their
+// references, and written as a gettext template and JSON.
+func TestCatalog(t *testing.T) {
+	var c Catalog
+	assert.NoError(t, c.Extract(NewScanner(strings.NewReader("<%t \"Hello, {name}\" name=n %>\n<%t `Say \"hi\"\n` %>"), "views/a.egon")))
+	assert.NoError(t, c.Extract(NewScanner(strings.NewReader("<p>\n<%t \"Hello, {name}\" name=m %></p><%t \"{n} file\" \"{n} files\" n=1 %>"), "views/b.egon")))
+	assert.NoError(t, c.Extract(NewScanner(strings.NewReader("<%t \"{n} file\" n=1 %>"), "views/c.egon")))
+
+	var buf bytes.Buffer
+	assert.NoError(t, c.WritePOT(&buf))
+	assert.Equal(t, `msgid ""
+msgstr ""
+"Content-Type: text/plain; charset=UTF-8\n"
+
+#: views/a.egon:1
+#: views/b.egon:2
+msgid "Hello, {name}"
+msgstr ""
+
+#: views/a.egon:2
+msgid "Say \"hi\"\n"
+msgstr ""
+
+#: views/b.egon:2
+#: views/c.egon:1
+msgid "{n} file"
+msgid_plural "{n} files"
+msgstr[0] ""
+msgstr[1] ""
+`, buf.String())
+
+	buf.Reset()
+	assert.NoError(t, c.WriteJSON(&buf))
+	assert.JSONEq(t, `[
+		{"id": "Hello, {name}", "references": ["views/a.egon:1", "views/b.egon:2"]},
+		{"id": "Say \"hi\"\n", "references": ["views/a.egon:2"]},
+		{"id": "{n} file", "plural": "{n} files", "references": ["views/b.egon:2", "views/c.egon:1"]}
+	]`, buf.String())
+}
+
+// Ensure that a message used with two plural forms is an error.
+func TestCatalog_PluralConflict(t *testing.T) {
+	var c Catalog
+	assert.NoError(t, c.Extract(NewScanner(strings.NewReader("<%t \"{n} file\" \"{n} files\" n=1 %>"), "views/a.egon")))
+	err := c.Extract(NewScanner(strings.NewReader("\n<%t \"{n} file\" \"{n} documents\" n=1 %>"), "views/b.egon"))
+	if assert.Error(t, err) {
+		assert.Equal(t, `views/b.egon:2: message "{n} file" has the plural form "{n} documents", and "{n} files" at views/a.egon:1`, err.Error())
+	}
+}
+
+// Ensure that the messages of template files are extracted.
+func TestCatalog_ExtractFile(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplates(t, dir, map[string]string{"page.egon": "{%t \"Hi\" %}"})
+
+	var c Catalog
+	assert.NoError(t, c.ExtractFile(filepath.Join(dir, "page.egon"), &Config{Delims: Delims{Open: "{%", Close: "%}"}}))
+	if assert.Len(t, c.Messages, 1) {
+		assert.Equal(t, "Hi", c.Messages[0].ID)
+	}
+	assert.Error(t, c.ExtractFile(filepath.Join(dir, "missing.egon"), nil))
+}
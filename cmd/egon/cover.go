@@ -0,0 +1,92 @@
+package main
+
+import (
+	"go/scanner"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/titpetric/egon"
+)
+
+var (
+	coverProfile string
+	coverHTML    string
+	coverOutput  string
+)
+
+func init() {
+	coverCmd.Flag("typesafe", "regenerate templates without a source map with type inference, like generate").Short('t').Default("true").BoolVar(&config.Typesafe)
+	coverCmd.Flag("html", "write the templates annotated with their coverage to an HTML file").StringVar(&coverHTML)
+	coverCmd.Flag("output", "write the profile rewritten to template positions to a file").Short('o').StringVar(&coverOutput)
+	coverCmd.Arg("profile", "coverage profile written by go test -coverprofile").Required().StringVar(&coverProfile)
+}
+
+// coverTemplates reads the coverage profile at profile, and writes the
+// coverage of the templates in it as requested by the flags.
+func coverTemplates(profile string, out io.Writer) scanner.ErrorList {
+	var errs scanner.ErrorList
+	p, err := readProfile(profile)
+	if err != nil {
+		addError(&errs, profile, err)
+		return errs
+	}
+	coverage, rewritten, err := egon.Cover(p, &config)
+	if err != nil {
+		addError(&errs, profile, err)
+		return errs
+	}
+	for _, c := range coverage {
+		c.Path = displayPath(c.Path)
+	}
+
+	if err := egon.WriteCoverage(out, coverage); err != nil {
+		addError(&errs, "", err)
+	}
+	if coverHTML != "" {
+		if err := writeFile(coverHTML, func(w io.Writer) error { return egon.WriteCoverageHTML(w, coverage) }); err != nil {
+			addError(&errs, coverHTML, err)
+		}
+	}
+	if coverOutput != "" {
+		if err := writeFile(coverOutput, rewritten.Write); err != nil {
+			addError(&errs, coverOutput, err)
+		}
+	}
+	return errs
+}
+
+// readProfile reads the coverage profile at path.
+func readProfile(path string) (*egon.Profile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return egon.ReadProfile(f)
+}
+
+// displayPath returns path relative to the working directory, if it is
+// below it.
+func displayPath(path string) string {
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, path); err == nil && !strings.HasPrefix(rel, "..") {
+			return rel
+		}
+	}
+	return path
+}
+
+// writeFile creates the file at path and writes it with write.
+func writeFile(path string, write func(io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"go/scanner"
+	"io"
+
+	"github.com/titpetric/egon"
+)
+
+var (
+	extractFormat string
+	extractOutput string
+)
+
+func init() {
+	extractCmd.Flag("format", "catalog format: pot or json").Default("pot").EnumVar(&extractFormat, "pot", "json")
+	extractCmd.Flag("output", "write the catalog to a file instead of stdout").Short('o').StringVar(&extractOutput)
+	extractCmd.Arg("folders", "folders to be processed").StringsVar(&config.Folders)
+}
+
+// extractFolders collects the messages of the translation blocks of every
+// template in folders, and writes them to w or the --output file as a
+// catalog in the format given by --format.
+func extractFolders(folders []string, w io.Writer) scanner.ErrorList {
+	var errs scanner.ErrorList
+	v := findTemplates(folders, &errs)
+
+	var catalog egon.Catalog
+	for _, path := range v.paths {
+		if err := catalog.ExtractFile(path, &config); err != nil {
+			addError(&errs, path, err)
+		}
+	}
+
+	write := catalog.WritePOT
+	if extractFormat == "json" {
+		write = catalog.WriteJSON
+	}
+	var err error
+	if extractOutput != "" {
+		err = writeFile(extractOutput, write)
+	} else {
+		err = write(w)
+	}
+	if err != nil {
+		addError(&errs, extractOutput, err)
+	}
+	return errs
+}
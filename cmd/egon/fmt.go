@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/scanner"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/titpetric/egon"
+)
+
+var (
+	fmtWrite bool
+	fmtDiff  bool
+	fmtPaths []string
+)
+
+func init() {
+	fmtCmd.Flag("write", "write the result to the template file instead of stdout").Short('w').BoolVar(&fmtWrite)
+	fmtCmd.Flag("diff", "display diffs instead of rewriting templates").Short('d').BoolVar(&fmtDiff)
+	fmtCmd.Arg("paths", "templates or folders to be formatted, standard input if none").StringsVar(&fmtPaths)
+}
+
+// formatPaths formats the templates at paths, which may be folders, or
+// standard input if there are none.
+func formatPaths(paths []string) scanner.ErrorList {
+	var errs scanner.ErrorList
+	if len(paths) == 0 {
+		if err := formatFile("<standard input>", os.Stdin, os.Stdout); err != nil {
+			addError(&errs, "<standard input>", err)
+		}
+		return errs
+	}
+
+	var templates []string
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			templates = append(templates, path)
+			continue
+		}
+		templates = append(templates, findTemplates([]string{path}, &errs).paths...)
+	}
+	for _, path := range templates {
+		if err := formatFile(path, nil, os.Stdout); err != nil {
+			addError(&errs, path, err)
+		}
+	}
+	return errs
+}
+
+// formatFile formats the template at path, read from in if it isn't nil,
+// and writes the result as requested by the flags.
+func formatFile(path string, in io.Reader, out io.Writer) error {
+	var (
+		src []byte
+		err error
+	)
+	if in != nil {
+		src, err = io.ReadAll(in)
+	} else {
+		src, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return err
+	}
+
+	res, err := egon.Format(src, path, &config)
+	if err != nil {
+		return err
+	}
+
+	if bytes.Equal(src, res) && (fmtWrite || fmtDiff) {
+		return nil
+	}
+	if fmtWrite && in == nil {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, res, info.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+	if fmtDiff {
+		d, err := diff(path, src, res)
+		if err != nil {
+			return fmt.Errorf("computing diff: %s", err)
+		}
+		fmt.Fprintf(out, "diff -u %s.orig %s\n", filepath.ToSlash(path), filepath.ToSlash(path))
+		out.Write(d)
+	}
+	if !fmtWrite && !fmtDiff {
+		_, err = out.Write(res)
+	}
+	return err
+}
+
+// diff returns the unified diff of a and b, as given by the diff tool.
+func diff(path string, a, b []byte) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "egon-fmt")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Base(path)
+	if err := os.WriteFile(filepath.Join(dir, name+".orig"), a, 0644); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), b, 0644); err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command("diff", "-u", name+".orig", name)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if len(out) > 0 {
+		// diff exits with status 1 when the files differ.
+		return out, nil
+	}
+	return nil, err
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"go/scanner"
+	"io"
+
+	"github.com/titpetric/egon"
+)
+
+// lintFolders lints every template in folders and writes the problems found
+// to w in the format given by --format. It returns the templates that
+// couldn't be read, and the number of problems.
+func lintFolders(folders []string, w io.Writer) (scanner.ErrorList, int) {
+	var errs scanner.ErrorList
+	v := findTemplates(folders, &errs)
+
+	var problems []egon.Problem
+	for _, path := range v.paths {
+		p, err := egon.LintFile(path, &config)
+		if err != nil {
+			addError(&errs, path, err)
+		}
+		problems = append(problems, p...)
+	}
+
+	write := egon.WriteProblems
+	switch lintFormat {
+	case "json":
+		write = egon.WriteProblemsJSON
+	case "sarif":
+		write = egon.WriteProblemsSARIF
+	}
+	if err := write(w, problems); err != nil {
+		addError(&errs, "", err)
+	}
+	return errs, len(problems)
+}
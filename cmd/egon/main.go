@@ -3,69 +3,209 @@ package main
 import (
 	"fmt"
 	"go/scanner"
+	"go/token"
 	"log"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
 
 	"github.com/titpetric/egon"
+	"github.com/titpetric/egon/lsp"
 	"gopkg.in/alecthomas/kingpin.v2"
 )
 
+var (
+	config     egon.Config
+	maxErrors  int
+	jobs       int
+	lintFormat string
+	delims     string
+)
+
+var (
+	generateCmd = kingpin.Command("generate", "generate Go code from templates").Default()
+	lintCmd     = kingpin.Command("lint", "report raw prints, unused parameters and unsafe print blocks")
+	fmtCmd      = kingpin.Command("fmt", "format templates")
+	lspCmd      = kingpin.Command("lsp", "run the language server on standard input and output")
+	coverCmd    = kingpin.Command("cover", "report the template lines covered by a Go coverage profile")
+	extractCmd  = kingpin.Command("extract", "write the messages of translation blocks to a gettext or JSON catalog")
+)
+
 func init() {
 	kingpin.Version("0.9.0")
-	kingpin.Flag("extension", "templatefile extension").Short('e').Default("egon").StringVar(&egon.Config.TmplExtension)
-	kingpin.Flag("typesafe", "if present use provided flags for format-string").Short('t').Default("true").BoolVar(&egon.Config.Typesafe)
-	kingpin.Flag("stropt", "optimise string handling to reduce allocations").Short('s').Default("true").BoolVar(&egon.Config.StringOptimisations)
-	kingpin.Flag("debug", "include debug comments in generated code").Short('d').Default("false").BoolVar(&egon.Config.Debug)
-	kingpin.Flag("minify", "remove whitespace from output").Short('m').Default("false").BoolVar(&egon.Config.Minify)
-	kingpin.Arg("folders", "folders to be processed").StringsVar(&egon.Config.Folders)
+	kingpin.Flag("extension", "templatefile extension").Short('e').Default("egon").StringVar(&config.TmplExtension)
+	kingpin.Flag("stropt", "optimise string handling to reduce allocations").Short('s').Default("true").BoolVar(&config.StringOptimisations)
+	kingpin.Flag("delims", `block delimiters, e.g. "{% %}"`).Default("<% %>").StringVar(&delims)
+	kingpin.Flag("max-errors", "maximum number of errors to report, 0 for no limit").Default("10").IntVar(&maxErrors)
+
+	generateCmd.Flag("typesafe", "infer print block format codes from the types of their expressions").Short('t').Default("true").BoolVar(&config.Typesafe)
+	generateCmd.Flag("debug", "include debug comments in generated code").Short('d').Default("false").BoolVar(&config.Debug)
+	generateCmd.Flag("minify", "remove whitespace from output").Short('m').Default("false").BoolVar(&config.Minify)
+	generateCmd.Flag("views", "generate a View func for every template").BoolVar(&config.Views)
+	generateCmd.Flag("registry", "register template views by name, implies --views").BoolVar(&config.Registry)
+	generateCmd.Flag("sourcemap", "write a source map of the generated code next to every template").BoolVar(&config.SourceMap)
+	generateCmd.Flag("jobs", "number of templates to generate in parallel").Short('j').Default(fmt.Sprint(runtime.NumCPU())).IntVar(&jobs)
+	generateCmd.Arg("folders", "folders to be processed").StringsVar(&config.Folders)
+
+	lintCmd.Flag("format", "output format: text, json or sarif").Default("text").EnumVar(&lintFormat, "text", "json", "sarif")
+	lintCmd.Arg("folders", "folders to be processed").StringsVar(&config.Folders)
 }
 
 func main() {
 	log.SetFlags(0)
 	kingpin.CommandLine.Help = "Generate native Go code from ERB-style Templates"
-	kingpin.Parse()
+	command := kingpin.Parse()
+
+	fields := strings.Fields(delims)
+	if len(fields) != 2 {
+		kingpin.Fatalf("--delims should be the open and close delimiters separated by a space, got %q", delims)
+	}
+	config.Delims = egon.Delims{Open: fields[0], Close: fields[1]}
 
-	if len(egon.Config.Folders) == 0 {
-		egon.Config.Folders = []string{"."}
+	if len(config.Folders) == 0 {
+		config.Folders = []string{"."}
 	}
+	config.Importer = egon.NewImporter()
+
+	var (
+		errs     scanner.ErrorList
+		problems int
+	)
+	switch command {
+	case generateCmd.FullCommand():
+		errs = generateFolders(config.Folders)
+	case lintCmd.FullCommand():
+		errs, problems = lintFolders(config.Folders, os.Stdout)
+	case fmtCmd.FullCommand():
+		errs = formatPaths(fmtPaths)
+	case coverCmd.FullCommand():
+		errs = coverTemplates(coverProfile, os.Stdout)
+	case extractCmd.FullCommand():
+		errs = extractFolders(config.Folders, os.Stdout)
+	case lspCmd.FullCommand():
+		if err := lsp.NewServer(&config).Serve(os.Stdin, os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if len(errs) > 0 {
+		errs.Sort()
+		truncated := maxErrors > 0 && len(errs) > maxErrors
+		if truncated {
+			errs = errs[:maxErrors]
+		}
+		scanner.PrintError(os.Stderr, errs)
+		if truncated {
+			fmt.Fprintln(os.Stderr, "too many errors")
+		}
+		os.Exit(1)
+	}
+	if problems > 0 {
+		os.Exit(1)
+	}
+}
 
-	// Recursively retrieve all templates
-	var v visitor
-	for _, root := range egon.Config.Folders {
+// findTemplates recursively retrieves all templates in folders.
+func findTemplates(folders []string, errs *scanner.ErrorList) *visitor {
+	v := &visitor{extension: "." + config.TmplExtension}
+	for _, root := range folders {
 		log.Printf("scanning folder [%s]", root)
+		v.root = root
 		if err := filepath.Walk(root, v.visit); err != nil {
-			scanner.PrintError(os.Stderr, err)
-			os.Exit(1)
+			addError(errs, root, err)
 		}
 	}
+	return v
+}
 
-	// Parse every *.ego file.
-	for _, path := range v.paths {
-		template, err := egon.ParseFile(path)
+// generateFolders generates every template in folders, carrying on past
+// failures so that all broken templates are reported in a single run.
+func generateFolders(folders []string) scanner.ErrorList {
+	var errs scanner.ErrorList
+	v := findTemplates(folders, &errs)
+	for i, err := range generateAll(v.paths, v.roots, jobs) {
 		if err != nil {
-			log.Fatal("parse file: ", err)
+			addError(&errs, v.paths[i], err)
 		}
+	}
+	return errs
+}
 
-		pkg := &egon.Package{Template: template}
-		err = pkg.Write()
-		if err != nil {
-			log.Fatal("write: ", err)
+// generateAll generates the templates at paths, found in the folders at
+// the same index of roots, using a pool of workers. The returned errors are
+// indexed like paths, so the result doesn't depend on the order in which the
+// workers finish.
+func generateAll(paths, roots []string, workers int) []error {
+	if workers < 1 {
+		workers = 1
+	}
+
+	errs := make([]error, len(paths))
+	queue := make(chan int)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				errs[i] = generate(paths[i], roots[i])
+			}
+		}()
+	}
+	for i := range paths {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+
+	return errs
+}
+
+// generate parses the template at path and writes out its Go source.
+func generate(path, root string) error {
+	template, err := egon.ParseFileConfig(path, &config)
+	if err != nil {
+		return err
+	}
+	template.Root = root
+
+	pkg := &egon.Package{Template: template}
+	return pkg.Write()
+}
+
+// addError records err against path, keeping any position information
+// the error already carries.
+func addError(errs *scanner.ErrorList, path string, err error) {
+	switch err := err.(type) {
+	case scanner.ErrorList:
+		for _, e := range err {
+			errs.Add(e.Pos, e.Msg)
 		}
+	case *scanner.Error:
+		errs.Add(err.Pos, err.Msg)
+	default:
+		errs.Add(token.Position{Filename: path}, err.Error())
 	}
 }
 
-// visitor iterates over
+// visitor iterates over a folder and collects template paths.
 type visitor struct {
-	paths []string
+	extension string
+	root      string
+	paths     []string
+	roots     []string
 }
 
 func (v *visitor) visit(path string, info os.FileInfo, err error) error {
 	if info == nil {
 		return fmt.Errorf("file not found: %s", path)
 	}
-	if !info.IsDir() && filepath.Ext(path) == ("."+egon.Config.TmplExtension) {
+	if !info.IsDir() && filepath.Ext(path) == v.extension {
 		v.paths = append(v.paths, path)
+		v.roots = append(v.roots, v.root)
 	}
 	return nil
 }
@@ -0,0 +1,217 @@
+package egon
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"go/types"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// resolveComponents returns blocks with their component and end blocks
+// copied and bound to the template funcs they call. The children of a
+// component without a children parameter must be blank, and are dropped.
+func (t *Template) resolveComponents(blocks []Block) ([]Block, error) {
+	var (
+		out      []Block
+		open     []*ComponentBlock
+		resolved = map[string]*componentFunc{}
+	)
+	for _, b := range blocks {
+		if n := len(open); n > 0 && !open[n-1].hasChildren() {
+			if _, ok := b.(*EndBlock); !ok {
+				if text, ok := b.(*TextBlock); ok && strings.TrimSpace(text.Content) == "" {
+					continue
+				}
+				return nil, scanError(blockPos(b), fmt.Errorf("component %s has no children parameter", open[n-1].Name))
+			}
+		}
+
+		switch b := b.(type) {
+		case *ComponentBlock:
+			target := resolved[b.Name]
+			if target == nil {
+				var err error
+				if target, err = t.component(b.Name); err != nil {
+					return nil, scanError(b.Pos, err)
+				}
+				resolved[b.Name] = target
+			}
+			c := *b
+			c.target = target
+			for _, arg := range c.Args {
+				if !target.hasParam(arg.Name) {
+					return nil, scanError(b.Pos, fmt.Errorf("component %s has no parameter %s", b.Name, arg.Name))
+				}
+			}
+			out = append(out, &c)
+			if !c.SelfClosing {
+				open = append(open, &c)
+			}
+		case *EndBlock:
+			if len(open) == 0 {
+				return nil, scanError(b.Pos, ErrUnmatchedEnd)
+			}
+			e := *b
+			e.open, open = open[len(open)-1], open[:len(open)-1]
+			out = append(out, &e)
+		default:
+			out = append(out, b)
+		}
+	}
+	if len(open) > 0 {
+		return nil, scanError(open[len(open)-1].Pos, ErrUnclosedComponent)
+	}
+	return out, nil
+}
+
+// hasParam returns whether f has a parameter name.
+func (f *componentFunc) hasParam(name string) bool {
+	for _, param := range f.params {
+		if param.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// component returns the template func of the component name. A qualified
+// name is looked up in the folder of the package the template imports under
+// the qualifier.
+func (t *Template) component(name string) (*componentFunc, error) {
+	dir, qualifier := filepath.Dir(t.Path), ""
+	if i := strings.IndexByte(name, '.'); i >= 0 {
+		qualifier = name[:i]
+		importPath, ok := t.importPath(qualifier)
+		if !ok {
+			return nil, fmt.Errorf("component %s: package %s is not imported", name, qualifier)
+		}
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, err
+		}
+		pkg, err := build.Import(importPath, abs, build.FindOnly)
+		if err != nil {
+			return nil, fmt.Errorf("component %s: %s", name, err)
+		}
+		dir = pkg.Dir
+	}
+
+	target, err := t.findTemplate(dir, name[strings.IndexByte(name, '.')+1:])
+	if err != nil {
+		return nil, fmt.Errorf("component %s: %s", name, err)
+	}
+	f := &componentFunc{name: target.TemplateFuncName()}
+	if qualifier != "" {
+		f.name = qualifier + "." + f.name
+	}
+	imports := target.imports()
+	for _, param := range target.parameterBlocks() {
+		p := componentParam{name: param.ParamName}
+		var err error
+		if p.typ, p.imports, err = qualifyType(param.ParamType, qualifier, imports); err != nil {
+			return nil, fmt.Errorf("component %s: parameter %s: %s", name, param.ParamName, err)
+		}
+		f.params = append(f.params, p)
+	}
+	return f, nil
+}
+
+// qualifyType rewrites the type expression typ of a parameter of a
+// component, so that names declared in its package are qualified with
+// qualifier, if it isn't empty. It returns the specs of the imports the
+// type refers to, from imports, the import specs of the component by name.
+func qualifyType(typ, qualifier string, imports map[string]string) (string, []string, error) {
+	expr, err := parser.ParseExpr(typ)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var specs []string
+	skip := map[*ast.Ident]bool{}
+	ast.Inspect(expr, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.Field:
+			for _, name := range n.Names {
+				skip[name] = true
+			}
+		case *ast.SelectorExpr:
+			if x, ok := n.X.(*ast.Ident); ok {
+				if spec, ok := imports[x.Name]; ok {
+					specs = append(specs, spec)
+				}
+				return false
+			}
+		case *ast.Ident:
+			if qualifier != "" && !skip[n] && types.Universe.Lookup(n.Name) == nil {
+				n.Name = qualifier + "." + n.Name
+			}
+		}
+		return true
+	})
+
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, token.NewFileSet(), expr); err != nil {
+		return "", nil, err
+	}
+	return buf.String(), specs, nil
+}
+
+// findTemplate parses the template in dir whose name is name.
+func (t *Template) findTemplate(dir, name string) (*Template, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*."+t.Config.orDefault().tmplExtension()))
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range paths {
+		if (&Template{Path: p}).Name() == name {
+			return ParseFileConfig(p, t.Config)
+		}
+	}
+	return nil, fmt.Errorf("no template %s in %s", name, dir)
+}
+
+// importPath returns the path of the package the header blocks of the
+// template import under name.
+func (t *Template) importPath(name string) (string, bool) {
+	spec, ok := t.imports()[name]
+	if !ok {
+		return "", false
+	}
+	p, err := strconv.Unquote(spec[strings.IndexByte(spec, '"'):])
+	return p, err == nil
+}
+
+// imports returns the specs of the imports of the header blocks of the
+// template, by the name they are imported under. Packages imported without
+// a name are assumed to be named after the last element of their path.
+func (t *Template) imports() map[string]string {
+	src := "package egon\n"
+	for _, b := range t.headerBlocks() {
+		src += b.Content + "\n"
+	}
+	f, err := parser.ParseFile(token.NewFileSet(), "", src, parser.ImportsOnly)
+	if err != nil {
+		return nil
+	}
+	imports := map[string]string{}
+	for _, spec := range f.Imports {
+		p, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		if spec.Name != nil {
+			imports[spec.Name.Name] = spec.Name.Name + " " + spec.Path.Value
+		} else {
+			imports[path.Base(p)] = spec.Path.Value
+		}
+	}
+	return imports
+}
@@ -0,0 +1,117 @@
+package egon_test
+
+import (
+	"bytes"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	. "github.com/titpetric/egon"
+)
+
+// Ensure that component and end blocks can be scanned.
+func TestScannerComponentBlock(t *testing.T) {
+	s := NewScanner(bytes.NewBufferString(`<%@ component ui.Card title="Hi, " + name class=css("card") %><%@ component Icon name="star" / %><%@ end %>`), "tmpl.egon")
+	b, err := s.Scan()
+	assert.NoError(t, err)
+	if b, ok := b.(*ComponentBlock); assert.True(t, ok) {
+		assert.Equal(t, "ui.Card", b.Name)
+		if assert.Len(t, b.Args, 2) {
+			assert.Equal(t, "title", b.Args[0].Name)
+			assert.Equal(t, `"Hi, " + name`, b.Args[0].Expr)
+			assert.Equal(t, "class", b.Args[1].Name)
+			assert.Equal(t, `css("card")`, b.Args[1].Expr)
+		}
+		assert.False(t, b.SelfClosing)
+	}
+
+	b, err = s.Scan()
+	assert.NoError(t, err)
+	if b, ok := b.(*ComponentBlock); assert.True(t, ok) {
+		assert.Equal(t, "Icon", b.Name)
+		assert.Equal(t, `"star"`, b.Args[0].Expr)
+		assert.True(t, b.SelfClosing)
+	}
+
+	b, err = s.Scan()
+	assert.NoError(t, err)
+	assert.IsType(t, &EndBlock{}, b)
+}
+
+// Ensure that badly formed component blocks return an error.
+func TestScannerComponentBlockFormat(t *testing.T) {
+	for _, src := range []string{`<%@ component %>`, `<%@ component "Card" %>`, `<%@ component Card title %>`, `<%@ component Card a=1 a=2 %>`, `<%@ component Card children=f %>`, `<%@ end x %>`, `<%@ children x %>`} {
+		_, err := NewScanner(bytes.NewBufferString(src), "tmpl.egon").Scan()
+		assert.Equal(t, ErrDirectiveFormat, err, src)
+	}
+}
+
+// writeTemplates writes the templates in files to dir.
+func writeTemplates(t *testing.T, dir string, files map[string]string) {
+	for name, src := range files {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, os.WriteFile(path, []byte(src), 0644))
+	}
+}
+
+// Ensure that component blocks call the template funcs of their templates,
+// with their children as a func.
+func TestTemplate_WriteComponents(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "views")
+	writeTemplates(t, dir, map[string]string{
+		"card.egon":      "<%! title string %><%! children func(io.Writer) error %><%! footer *Footer %><h2><%= title %></h2><%@ children %>",
+		"icon.egon":      "<%! name string %><i><%= name %></i>",
+		"ui/button.egon": "<%% import t \"time\" %%><%! label string %><%! at t.Time %><%! u *User %><%! on func(*Event) %><button><%= label %></button>",
+	})
+
+	src := "<%% import \"./ui\" %%>" +
+		"<%@ component Card title=\"Hi, \" + name %><p><%= name %></p>" +
+		"<%@ component Icon name=\"star\" / %>" +
+		"<%@ end %>" +
+		"<%@ component Icon %>\n<%@ end %>" +
+		"<%@ component ui.Button label=name / %>"
+	tmpl, err := Parse(strings.NewReader(src), filepath.Join(dir, "page.egon"))
+	assert.NoError(t, err)
+
+	out := tmpl.String()
+	assert.Contains(t, out, "if err := CardTemplate(w, \"Hi, \" + name, func(w io.Writer) error {\n")
+	assert.Contains(t, out, "if err := IconTemplate(w, \"star\"); err != nil {\nreturn err\n}\nreturn nil\n}, *new(*Footer)); err != nil {\nreturn err\n}\n")
+	assert.Contains(t, out, "if err := IconTemplate(w, *new(string)); err != nil {\nreturn err\n}\nif err := ui.ButtonTemplate(w, name, *new(t.Time), *new(*ui.User), *new(func(*ui.Event))); err != nil {")
+	assert.Contains(t, out, "t \"time\"\n")
+	_, err = parser.ParseFile(token.NewFileSet(), "page.egon.go", out, 0)
+	assert.NoError(t, err)
+
+	card, err := ParseFile(filepath.Join(dir, "card.egon"))
+	assert.NoError(t, err)
+	assert.Contains(t, card.String(), "if children != nil {\nif err := children(w); err != nil {\nreturn err\n}\n}\n")
+}
+
+// Ensure that components that can't be resolved or don't nest return an
+// error at the offending block.
+func TestTemplate_WriteComponentsError(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "views")
+	writeTemplates(t, dir, map[string]string{
+		"icon.egon": "<%! name string %><i><%= name %></i>",
+	})
+
+	for src, msg := range map[string]string{
+		"\n<%@ component Icon %>":                   "page.egon:2: " + ErrUnclosedComponent.Error(),
+		"\n<%@ end %>":                              "page.egon:2: " + ErrUnmatchedEnd.Error(),
+		"\n<%@ component Nav / %>":                  "page.egon:2: component Nav: no template Nav in ",
+		"\n<%@ component ui.Nav / %>":               "page.egon:2: component ui.Nav: package ui is not imported",
+		"\n<%@ component Icon size=1 / %>":          "page.egon:2: component Icon has no parameter size",
+		"<%@ component Icon %>\n<%= x %><%@ end %>": "page.egon:2: component Icon has no children parameter",
+	} {
+		tmpl, err := Parse(strings.NewReader(src), filepath.Join(dir, "page.egon"))
+		assert.NoError(t, err)
+		err = tmpl.Write(&bytes.Buffer{})
+		if assert.Error(t, err, src) {
+			assert.Contains(t, err.Error(), msg)
+		}
+	}
+}
@@ -1,6 +1,10 @@
 package egon
 
-var Config struct {
+import "go/types"
+
+// Config holds the options used when parsing and generating templates.
+// A nil *Config behaves like the zero value.
+type Config struct {
 	Typesafe            bool
 	StringOptimisations bool
 	TmplExtension       string
@@ -8,4 +12,59 @@ var Config struct {
 	Folders             []string
 	Debug               bool
 	Minify              bool
+	Views               bool
+	Registry            bool
+	SourceMap           bool
+
+	// Delims are the delimiters of blocks, DefaultDelims if they are
+	// empty.
+	Delims Delims
+
+	// Importer imports the packages templates use when they are type
+	// checked. A run that generates or checks many templates should share
+	// one from NewImporter, so each package is only checked once; a new
+	// importer is used for every template if it is nil.
+	Importer types.ImporterFrom
+}
+
+// Delims are the delimiters that open and close template blocks. The
+// markers of the block types follow the open delimiter, so with "{%" and
+// "%}" print blocks are written as {%= x %}, and comments as {%# x #%}.
+type Delims struct {
+	Open, Close string
+}
+
+// DefaultDelims are the delimiters of ERB templates.
+var DefaultDelims = Delims{Open: "<%", Close: "%>"}
+
+// orDefault returns c, or an empty configuration if c is nil.
+func (c *Config) orDefault() *Config {
+	if c == nil {
+		return &Config{}
+	}
+	return c
+}
+
+// tmplExtension returns the extension of template files, without the dot.
+func (c *Config) tmplExtension() string {
+	if c.TmplExtension == "" {
+		return "egon"
+	}
+	return c.TmplExtension
+}
+
+// delims returns the delimiters configured in c.
+func (c *Config) delims() Delims {
+	if c.Delims.Open == "" || c.Delims.Close == "" {
+		return DefaultDelims
+	}
+	return c.Delims
+}
+
+// importer returns the importer configured in c, or a new one.
+func (c *Config) importer() types.ImporterFrom {
+	if c.Importer == nil {
+		return NewImporter()
+	}
+	return c.Importer
 }
@@ -0,0 +1,374 @@
+package egon
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/build"
+	"go/scanner"
+	"go/token"
+	"html/template"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Profile is a coverage profile, as written by go test -coverprofile.
+type Profile struct {
+	Mode   string
+	Blocks []ProfileBlock
+}
+
+// ProfileBlock is a block of statements of a file in a coverage profile,
+// with the number of times it ran. Lines and columns are 1-based, and the
+// end column is exclusive.
+type ProfileBlock struct {
+	File                                 string
+	StartLine, StartCol, EndLine, EndCol int
+	NumStmt, Count                       int
+}
+
+// Coverage is the line coverage of a template.
+type Coverage struct {
+	Path   string      // the template file
+	Lines  []string    // the template source, by line
+	Counts map[int]int // the highest count of the statements on a line, by line number
+
+	// Blocks are the profile blocks of the generated code, moved to the
+	// lines of the template they were generated from.
+	Blocks []ProfileBlock
+}
+
+// ReadProfile reads a coverage profile from r.
+func ReadProfile(r io.Reader) (*Profile, error) {
+	p := &Profile{}
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := s.Text()
+		if n == 1 {
+			if !strings.HasPrefix(line, "mode: ") {
+				return nil, fmt.Errorf("not a coverage profile")
+			}
+			p.Mode = strings.TrimPrefix(line, "mode: ")
+			continue
+		}
+		if line == "" {
+			continue
+		}
+		var (
+			b   ProfileBlock
+			err error
+		)
+		i := strings.LastIndexByte(line, ':')
+		if i >= 0 {
+			b.File = line[:i]
+			_, err = fmt.Sscanf(line[i+1:], "%d.%d,%d.%d %d %d", &b.StartLine, &b.StartCol, &b.EndLine, &b.EndCol, &b.NumStmt, &b.Count)
+		}
+		if i < 0 || err != nil {
+			return nil, fmt.Errorf("line %d: invalid profile block: %q", n, line)
+		}
+		p.Blocks = append(p.Blocks, b)
+	}
+	return p, s.Err()
+}
+
+// Write writes p to w in the coverage profile format.
+func (p *Profile) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "mode: %s\n", p.Mode)
+	for _, b := range p.Blocks {
+		fmt.Fprintf(bw, "%s:%d.%d,%d.%d %d %d\n", b.File, b.StartLine, b.StartCol, b.EndLine, b.EndCol, b.NumStmt, b.Count)
+	}
+	return bw.Flush()
+}
+
+// Cover returns the coverage of the templates whose generated code is in p,
+// and p with the blocks of the generated code replaced by the blocks of
+// their templates. The files of the profile are found by their import path.
+// Templates that weren't generated with a source map are generated again
+// with config to map them, which only works if config matches the one they
+// were generated with. The errors of all templates are returned as a
+// scanner.ErrorList.
+func Cover(p *Profile, config *Config) ([]*Coverage, *Profile, error) {
+	var (
+		files  []string
+		byFile = map[string][]ProfileBlock{}
+	)
+	for _, b := range p.Blocks {
+		if _, ok := byFile[b.File]; !ok {
+			files = append(files, b.File)
+		}
+		byFile[b.File] = append(byFile[b.File], b)
+	}
+
+	var (
+		covered []*Coverage
+		errs    scanner.ErrorList
+	)
+	out := &Profile{Mode: p.Mode}
+	suffix := "." + config.orDefault().tmplExtension() + ".go"
+	for _, file := range files {
+		blocks := byFile[file]
+		if strings.HasSuffix(file, suffix) {
+			c, err := coverTemplate(file, blocks, config)
+			if err != nil {
+				addError(&errs, file, err)
+				continue
+			}
+			covered = append(covered, c)
+			blocks = c.Blocks
+		}
+		out.Blocks = append(out.Blocks, blocks...)
+	}
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+	return covered, out, nil
+}
+
+// addError adds err to errs, at path unless it carries its own positions.
+func addError(errs *scanner.ErrorList, path string, err error) {
+	switch err := err.(type) {
+	case scanner.ErrorList:
+		for _, e := range err {
+			errs.Add(e.Pos, e.Msg)
+		}
+	case *scanner.Error:
+		errs.Add(err.Pos, err.Msg)
+	default:
+		errs.Add(token.Position{Filename: path}, err.Error())
+	}
+}
+
+// coverTemplate maps the profile blocks of the generated code of a
+// template, named file in the profile, to the lines of the template.
+func coverTemplate(file string, blocks []ProfileBlock, config *Config) (*Coverage, error) {
+	genPath, err := findProfileFile(file)
+	if err != nil {
+		return nil, err
+	}
+	gen, err := os.ReadFile(genPath)
+	if err != nil {
+		return nil, err
+	}
+	tmplPath := strings.TrimSuffix(genPath, ".go")
+	src, err := os.ReadFile(tmplPath)
+	if err != nil {
+		return nil, err
+	}
+	m, err := loadSourceMap(tmplPath, gen, config)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Coverage{
+		Path:   tmplPath,
+		Lines:  strings.Split(strings.TrimSuffix(string(src), "\n"), "\n"),
+		Counts: map[int]int{},
+	}
+	name := strings.TrimSuffix(file, ".go")
+	genLines := strings.Split(string(gen), "\n")
+	for _, b := range blocks {
+		first, last := 0, 0
+		for line := b.StartLine; line <= b.EndLine && line <= len(genLines); line++ {
+			// A line belongs to the block that its first statement is in.
+			col := strings.IndexFunc(genLines[line-1], func(r rune) bool { return r != ' ' && r != '\t' }) + 1
+			if col == 0 || before(line, col, b.StartLine, b.StartCol) || !before(line, col, b.EndLine, b.EndCol) {
+				continue
+			}
+			pos, ok := m.Position(line, col)
+			if !ok || pos.Line > len(c.Lines) {
+				continue
+			}
+			if count, ok := c.Counts[pos.Line]; !ok || b.Count > count {
+				c.Counts[pos.Line] = b.Count
+			}
+			if first == 0 || pos.Line < first {
+				first = pos.Line
+			}
+			if pos.Line > last {
+				last = pos.Line
+			}
+		}
+		if first == 0 {
+			continue
+		}
+		c.Blocks = append(c.Blocks, ProfileBlock{
+			File:      name,
+			StartLine: first,
+			StartCol:  1,
+			EndLine:   last,
+			EndCol:    len(c.Lines[last-1]) + 1,
+			NumStmt:   b.NumStmt,
+			Count:     b.Count,
+		})
+	}
+	sort.SliceStable(c.Blocks, func(i, j int) bool {
+		return before(c.Blocks[i].StartLine, c.Blocks[i].StartCol, c.Blocks[j].StartLine, c.Blocks[j].StartCol)
+	})
+	return c, nil
+}
+
+// findProfileFile returns the path of a file named in a coverage profile,
+// which is usually its import path followed by the file name.
+func findProfileFile(file string) (string, error) {
+	if _, err := os.Stat(file); err == nil {
+		return file, nil
+	}
+	pkg, err := build.Import(path.Dir(file), ".", build.FindOnly)
+	if err != nil {
+		return "", fmt.Errorf("can't find %s: %s", file, err)
+	}
+	return filepath.Join(pkg.Dir, path.Base(file)), nil
+}
+
+// loadSourceMap returns the source map of the template at path, whose
+// generated code is gen. Templates generated without a source map are
+// generated again, which gives the same code if config is the same.
+func loadSourceMap(path string, gen []byte, config *Config) (*SourceMap, error) {
+	tmpl, err := ParseFileConfig(path, config)
+	if err != nil {
+		return nil, err
+	}
+	m, err := LoadSourceMap(tmpl.SourceMapFile())
+	if err == nil && !m.Matches(gen) {
+		return nil, fmt.Errorf("%s doesn't match the generated code, generate it again", tmpl.SourceMapFile())
+	}
+	if !os.IsNotExist(err) {
+		return m, err
+	}
+
+	var buf bytes.Buffer
+	if m, err = tmpl.WriteSourceMap(&buf); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(buf.Bytes(), gen) {
+		return nil, fmt.Errorf("generated code is out of date or was generated with other flags, generate it with --sourcemap")
+	}
+	return m, nil
+}
+
+// before returns whether line and column come before line2 and column2.
+func before(line, column, line2, column2 int) bool {
+	return line < line2 || line == line2 && column < column2
+}
+
+// Covered returns the number of covered lines of the template, and of its
+// lines with statements.
+func (c *Coverage) Covered() (int, int) {
+	covered := 0
+	for _, count := range c.Counts {
+		if count > 0 {
+			covered++
+		}
+	}
+	return covered, len(c.Counts)
+}
+
+// Missed returns the ranges of lines that aren't covered, like "3,7-9".
+func (c *Coverage) Missed() string {
+	var lines []int
+	for line, count := range c.Counts {
+		if count == 0 {
+			lines = append(lines, line)
+		}
+	}
+	sort.Ints(lines)
+
+	var ranges []string
+	for i := 0; i < len(lines); {
+		j := i
+		for j+1 < len(lines) && lines[j+1] == lines[j]+1 {
+			j++
+		}
+		if i == j {
+			ranges = append(ranges, strconv.Itoa(lines[i]))
+		} else {
+			ranges = append(ranges, fmt.Sprintf("%d-%d", lines[i], lines[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(ranges, ",")
+}
+
+// WriteCoverage writes the percentage of the covered lines of every
+// template, and the lines that aren't covered, followed by the total.
+func WriteCoverage(w io.Writer, coverage []*Coverage) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 1, '\t', 0)
+	var covered, total int
+	for _, c := range coverage {
+		n, t := c.Covered()
+		covered += n
+		total += t
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", c.Path, percent(n, t), c.Missed())
+	}
+	fmt.Fprintf(tw, "total\t%s\t\n", percent(covered, total))
+	return tw.Flush()
+}
+
+func percent(covered, total int) string {
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", 100*float64(covered)/float64(total))
+}
+
+var coverHTMLTemplate = template.Must(template.New("cover").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Template coverage</title>
+<style>
+body { font-family: sans-serif; }
+pre { font-family: monospace; line-height: 1.4; }
+.line { color: #888; user-select: none; }
+.covered { background: #dfd; }
+.missed { background: #fdd; }
+</style>
+</head>
+<body>
+{{- range .}}
+<h2>{{.Path}} <small>{{.Percent}}</small></h2>
+<pre>
+{{- range .Lines}}
+<span class="{{.Class}}"><span class="line">{{printf "%4d" .No}}</span>  {{.Text}}</span>
+{{- end}}
+</pre>
+{{- end}}
+</body>
+</html>
+`))
+
+// WriteCoverageHTML writes the source of the templates as an HTML page,
+// with the covered and missed lines highlighted.
+func WriteCoverageHTML(w io.Writer, coverage []*Coverage) error {
+	type line struct {
+		No          int
+		Text, Class string
+	}
+	type file struct {
+		Path, Percent string
+		Lines         []line
+	}
+
+	var files []file
+	for _, c := range coverage {
+		f := file{Path: c.Path, Percent: percent(c.Covered())}
+		for i, text := range c.Lines {
+			l := line{No: i + 1, Text: text}
+			if count, ok := c.Counts[i+1]; ok && count > 0 {
+				l.Class = "covered"
+			} else if ok {
+				l.Class = "missed"
+			}
+			f.Lines = append(f.Lines, l)
+		}
+		files = append(files, f)
+	}
+	return coverHTMLTemplate.Execute(w, files)
+}
@@ -0,0 +1,138 @@
+package egon_test
+
+import (
+	"bytes"
+	"go/scanner"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	. "github.com/titpetric/egon"
+)
+
+// Ensure that coverage profiles are read and written back as they were.
+func TestReadProfile(t *testing.T) {
+	src := "mode: set\nexample.com/app/views/page.egon.go:12.40,14.2 2 1\nexample.com/app/views/page.egon.go:14.2,16.3 1 0\n"
+	p, err := ReadProfile(strings.NewReader(src))
+	assert.NoError(t, err)
+	assert.Equal(t, "set", p.Mode)
+	assert.Equal(t, []ProfileBlock{
+		{File: "example.com/app/views/page.egon.go", StartLine: 12, StartCol: 40, EndLine: 14, EndCol: 2, NumStmt: 2, Count: 1},
+		{File: "example.com/app/views/page.egon.go", StartLine: 14, StartCol: 2, EndLine: 16, EndCol: 3, NumStmt: 1, Count: 0},
+	}, p.Blocks)
+
+	var buf bytes.Buffer
+	assert.NoError(t, p.Write(&buf))
+	assert.Equal(t, src, buf.String())
+
+	_, err = ReadProfile(strings.NewReader("x.go:1.1,2.2 1 1\n"))
+	assert.EqualError(t, err, "not a coverage profile")
+	_, err = ReadProfile(strings.NewReader("mode: set\nx.go:1.1 1\n"))
+	assert.EqualError(t, err, `line 2: invalid profile block: "x.go:1.1 1"`)
+}
+
+// Ensure that the profile written by go test for the generated code of a
+// template is mapped to the lines of the template, with and without a
+// source map.
+func TestCover(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go tool not available")
+	}
+
+	root := t.TempDir()
+	dir := filepath.Join(root, "views")
+	writeModule(t, root)
+	writeTemplates(t, dir, map[string]string{
+		"page.egon":    "<%! n int %>\n<p>\n<% if n > 0 { %>\n  positive\n<% } else { %>\n  negative\n<% } %>\n</p>\n",
+		"list.egon":    "<%! items []string %>\n<% for _, item := range items { %>\n  <li><%= item %></li>\n<% } %>\n",
+		"page_test.go": "package views\n\nimport (\n\t\"io\"\n\t\"testing\"\n)\n\nfunc TestPage(t *testing.T) {\n\tPageTemplate(io.Discard, 1)\n\tListTemplate(io.Discard, nil)\n}\n",
+	})
+	for name, config := range map[string]*Config{"page.egon": {SourceMap: true}, "list.egon": nil} {
+		tmpl, err := ParseFileConfig(filepath.Join(dir, name), config)
+		assert.NoError(t, err)
+		assert.NoError(t, (&Package{Template: tmpl}).Write())
+	}
+
+	// Packages are found in the module of the working directory.
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(root))
+	defer os.Chdir(wd)
+
+	cmd := exec.Command("go", "test", "-coverprofile=cover.out", "./views")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go test: %s\n%s", err, out)
+	}
+	f, err := os.Open("cover.out")
+	assert.NoError(t, err)
+	defer f.Close()
+	p, err := ReadProfile(f)
+	assert.NoError(t, err)
+
+	coverage, rewritten, err := Cover(p, nil)
+	assert.NoError(t, err)
+	if !assert.Len(t, coverage, 2) {
+		return
+	}
+	byName := map[string]*Coverage{}
+	for _, c := range coverage {
+		byName[filepath.Base(c.Path)] = c
+	}
+
+	page := byName["page.egon"]
+	assert.Equal(t, filepath.Join(dir, "page.egon"), page.Path)
+	assert.Equal(t, "<p>", page.Lines[1])
+	assert.True(t, page.Counts[4] > 0)
+	assert.Equal(t, 0, page.Counts[6])
+	assert.Equal(t, "6", page.Missed())
+
+	list := byName["list.egon"]
+	assert.Equal(t, "3", list.Missed())
+
+	for _, b := range rewritten.Blocks {
+		assert.Contains(t, []string{"example.com/app/views/page.egon", "example.com/app/views/list.egon"}, b.File)
+		assert.True(t, b.EndLine <= 9, "block %+v", b)
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, WriteCoverage(&buf, coverage))
+	assert.Contains(t, buf.String(), "total")
+	buf.Reset()
+	assert.NoError(t, WriteCoverageHTML(&buf, coverage))
+	assert.Contains(t, buf.String(), `<span class="missed"><span class="line">   6</span>    negative</span>`)
+	assert.Contains(t, buf.String(), `<span class="covered"><span class="line">   4</span>    positive</span>`)
+
+	// A template changed since it was generated can't be mapped, and
+	// neither can generated code that doesn't match its source map.
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "list.egon"), []byte("<%! items []string %>\n"), 0644))
+	gen, err := os.ReadFile(filepath.Join(dir, "page.egon.go"))
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "page.egon.go"), append(gen, "// edited\n"...), 0644))
+	_, _, err = Cover(p, nil)
+	if errs, ok := err.(scanner.ErrorList); assert.True(t, ok) && assert.Len(t, errs, 2) {
+		errs.Sort()
+		assert.Contains(t, errs[0].Msg, "generated code is out of date")
+		assert.Contains(t, errs[1].Msg, "page.egon.map.json doesn't match the generated code")
+	}
+}
+
+// writeModule writes the go.mod of a module at root that uses the egon
+// package of this source tree, which generated templates import.
+func writeModule(t *testing.T, root string) {
+	egon, err := filepath.Abs(".")
+	assert.NoError(t, err)
+	mod := "module example.com/app\n\n" +
+		"go 1.18\n\n" +
+		"require github.com/titpetric/egon v0.0.0\n\n" +
+		"replace github.com/titpetric/egon => " + strconv.Quote(egon) + "\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "go.mod"), []byte(mod), 0644))
+
+	// The go.sum of egon covers the modules it requires.
+	sum, err := os.ReadFile(filepath.Join(egon, "go.sum"))
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "go.sum"), sum, 0644))
+}
@@ -0,0 +1,255 @@
+package dev
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"go/types"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/titpetric/egon"
+)
+
+// build generates the template at templatePath and compiles it, along with
+// a helper program that renders it, into binary.
+func (r *Renderer) build(templatePath, binary string) error {
+	t, err := egon.ParseFileConfig(templatePath, r.Config)
+	if err != nil {
+		return err
+	}
+
+	var source bytes.Buffer
+	if err := t.Write(&source); err != nil {
+		return fmt.Errorf("dev: %s: %s", templatePath, err)
+	}
+
+	work, err := os.MkdirTemp(r.tempDir, "build")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(work)
+
+	// The generated source and the helper are only visible to the go tool
+	// through the overlay, so the package is built as if it was generated.
+	dir := filepath.Dir(templatePath)
+	helperDir := filepath.Join(dir, "_egon")
+	overlay := map[string]string{
+		t.SourceFile(): filepath.Join(work, "template.go"),
+	}
+	if err := os.WriteFile(overlay[t.SourceFile()], source.Bytes(), 0644); err != nil {
+		return err
+	}
+	overlayFile := filepath.Join(work, "overlay.json")
+	if err := writeOverlay(overlayFile, overlay); err != nil {
+		return err
+	}
+
+	importPath, err := r.run(dir, "list", "-overlay", overlayFile, "-f", "{{.ImportPath}}", ".")
+	if err != nil {
+		return fmt.Errorf("dev: %s: %s", templatePath, err)
+	}
+
+	helper, err := helperSource(t, strings.TrimSpace(importPath))
+	if err != nil {
+		return fmt.Errorf("dev: %s: %s", templatePath, err)
+	}
+	overlay[filepath.Join(helperDir, "main.go")] = filepath.Join(work, "main.go")
+	if err := os.WriteFile(filepath.Join(work, "main.go"), helper, 0644); err != nil {
+		return err
+	}
+	if err := writeOverlay(overlayFile, overlay); err != nil {
+		return err
+	}
+
+	if _, err := r.run(dir, "build", "-overlay", overlayFile, "-o", binary, "./_egon"); err != nil {
+		return fmt.Errorf("dev: %s: %s", templatePath, err)
+	}
+	return nil
+}
+
+// run runs the go tool in dir and returns its standard output.
+func (r *Renderer) run(dir string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(r.goCommand(), args...)
+	cmd.Dir = dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if stderr.Len() > 0 {
+			return "", fmt.Errorf("%s", bytes.TrimSpace(stderr.Bytes()))
+		}
+		return "", err
+	}
+	return stdout.String(), nil
+}
+
+func writeOverlay(filename string, replace map[string]string) error {
+	b, err := json.Marshal(struct{ Replace map[string]string }{replace})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, b, 0644)
+}
+
+func encodeArgs(args []interface{}) ([]byte, error) {
+	if args == nil {
+		args = []interface{}{}
+	}
+	return json.Marshal(args)
+}
+
+// helperSource returns the source of a program that decodes the template
+// parameters from standard input and renders the template to standard
+// output. The template package is imported from importPath.
+func helperSource(t *egon.Template, importPath string) ([]byte, error) {
+	imports, err := headerImports(t)
+	if err != nil {
+		return nil, err
+	}
+
+	var params []*egon.ParameterBlock
+	for _, b := range t.Blocks {
+		if b, ok := b.(*egon.ParameterBlock); ok {
+			params = append(params, b)
+		}
+	}
+
+	// Parameter types are declared relative to the template package, so
+	// unqualified names are qualified with it, and only the header imports
+	// that the types refer to are kept.
+	used := map[string]bool{}
+	paramTypes := make([]string, len(params))
+	for i, param := range params {
+		paramType, err := qualifyType(param.ParamType, "egontmpl", used)
+		if err != nil {
+			return nil, fmt.Errorf("parameter %s: %s", param.ParamName, err)
+		}
+		paramTypes[i] = paramType
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("package main\n\n")
+	buf.WriteString("import (\n")
+	buf.WriteString("egonbufio \"bufio\"\n")
+	buf.WriteString("egonjson \"encoding/json\"\n")
+	buf.WriteString("egonfmt \"fmt\"\n")
+	buf.WriteString("egonos \"os\"\n")
+	fmt.Fprintf(&buf, "egontmpl %q\n", importPath)
+	var names []string
+	for name := range imports {
+		if used[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&buf, "%s %q\n", name, imports[name])
+	}
+	buf.WriteString(")\n\n")
+
+	buf.WriteString("func main() {\n")
+	buf.WriteString("var args []egonjson.RawMessage\n")
+	buf.WriteString("check(egonjson.NewDecoder(egonos.Stdin).Decode(&args))\n")
+	fmt.Fprintf(&buf, "if len(args) != %d {\n", len(params))
+	fmt.Fprintf(&buf, "check(egonfmt.Errorf(\"expected %d arguments, got %%d\", len(args)))\n", len(params))
+	buf.WriteString("}\n")
+
+	args := []string{"w"}
+	for i, paramType := range paramTypes {
+		fmt.Fprintf(&buf, "var p%d %s\n", i, paramType)
+		fmt.Fprintf(&buf, "check(egonjson.Unmarshal(args[%d], &p%d))\n", i, i)
+		args = append(args, fmt.Sprintf("p%d", i))
+	}
+
+	buf.WriteString("w := egonbufio.NewWriter(egonos.Stdout)\n")
+	fmt.Fprintf(&buf, "check(egontmpl.%s(%s))\n", t.TemplateFuncName(), strings.Join(args, ", "))
+	buf.WriteString("check(w.Flush())\n")
+	buf.WriteString("}\n\n")
+
+	buf.WriteString("func check(err error) {\n")
+	buf.WriteString("if err != nil {\n")
+	buf.WriteString("egonfmt.Fprintln(egonos.Stderr, err)\n")
+	buf.WriteString("egonos.Exit(1)\n")
+	buf.WriteString("}\n")
+	buf.WriteString("}\n")
+
+	return format.Source(buf.Bytes())
+}
+
+// headerImports returns the packages imported by the template header
+// blocks, keyed by the name they are referred to by.
+func headerImports(t *egon.Template) (map[string]string, error) {
+	var src bytes.Buffer
+	src.WriteString("package egon\n")
+	for _, b := range t.Blocks {
+		if b, ok := b.(*egon.HeaderBlock); ok {
+			fmt.Fprintln(&src, b.Content)
+		}
+	}
+
+	f, err := parser.ParseFile(token.NewFileSet(), "header.go", src.String(), parser.ImportsOnly)
+	if err != nil {
+		return nil, err
+	}
+
+	imports := map[string]string{}
+	for _, s := range f.Imports {
+		importPath, err := strconv.Unquote(s.Path.Value)
+		if err != nil {
+			return nil, err
+		}
+		name := path.Base(importPath)
+		if s.Name != nil {
+			name = s.Name.Name
+		}
+		imports[name] = importPath
+	}
+	return imports, nil
+}
+
+// qualifyType rewrites the type expression typ so that names declared in
+// the template package are qualified with pkg. Package names referenced by
+// the type are recorded in used.
+func qualifyType(typ, pkg string, used map[string]bool) (string, error) {
+	expr, err := parser.ParseExpr(typ)
+	if err != nil {
+		return "", err
+	}
+
+	skip := map[*ast.Ident]bool{}
+	ast.Inspect(expr, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.Field:
+			for _, name := range n.Names {
+				skip[name] = true
+			}
+		case *ast.SelectorExpr:
+			if x, ok := n.X.(*ast.Ident); ok {
+				used[x.Name] = true
+				return false
+			}
+		case *ast.Ident:
+			if !skip[n] && types.Universe.Lookup(n.Name) == nil {
+				n.Name = pkg + "." + n.Name
+			}
+		}
+		return true
+	})
+
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, token.NewFileSet(), expr); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
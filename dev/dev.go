@@ -0,0 +1,149 @@
+// Package dev renders egon templates straight from their .egon sources,
+// so a development server picks up template edits without being rebuilt.
+//
+// Each template is generated in memory and compiled, together with a small
+// helper program, by the go tool using an overlay; nothing is written to the
+// source tree. Rendering runs the helper as a subprocess and passes the
+// template parameters to it as JSON, so parameter types must round-trip
+// through encoding/json. Compiled helpers are cached until the template
+// changes.
+//
+// Production builds should keep using the generated code.
+package dev
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/titpetric/egon"
+)
+
+// Renderer compiles and renders templates on demand.
+type Renderer struct {
+	// Config is used when parsing and generating templates.
+	Config *egon.Config
+
+	// GoCommand is the go tool used to build templates, "go" by default.
+	GoCommand string
+
+	mu      sync.Mutex
+	tempDir string
+	cache   map[string]*program
+	builds  int
+}
+
+// program is a compiled helper for a single template.
+type program struct {
+	modTime time.Time
+	binary  string
+}
+
+// NewRenderer returns a Renderer that generates templates with config.
+func NewRenderer(config *egon.Config) *Renderer {
+	return &Renderer{
+		Config: config,
+		cache:  make(map[string]*program),
+	}
+}
+
+// Render renders the template at path to w, passing args as the template
+// parameters in the order they are declared. The output is buffered, so
+// nothing is written to w if the template fails.
+func (r *Renderer) Render(w io.Writer, path string, args ...interface{}) error {
+	p, err := r.program(path)
+	if err != nil {
+		return err
+	}
+
+	input, err := encodeArgs(args)
+	if err != nil {
+		return fmt.Errorf("dev: %s: %s", path, err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(p.binary)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("dev: %s: %s", path, bytes.TrimSpace(stderr.Bytes()))
+	}
+	_, err = stdout.WriteTo(w)
+	return err
+}
+
+// View returns a view that renders the template at path with args.
+func (r *Renderer) View(path string, args ...interface{}) *egon.View {
+	return &egon.View{
+		Name:         filepath.Base(path),
+		TemplatePath: path,
+		RenderFunc: func(w io.Writer) error {
+			return r.Render(w, path, args...)
+		},
+	}
+}
+
+// Close removes the compiled helpers.
+func (r *Renderer) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cache = make(map[string]*program)
+	if r.tempDir == "" {
+		return nil
+	}
+	err := os.RemoveAll(r.tempDir)
+	r.tempDir = ""
+	return err
+}
+
+// program returns the compiled helper for the template at path, building
+// it if the template changed since it was last built.
+func (r *Renderer) program(path string) (*program, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if p, ok := r.cache[path]; ok && p.modTime.Equal(info.ModTime()) {
+		return p, nil
+	}
+
+	if r.tempDir == "" {
+		if r.tempDir, err = os.MkdirTemp("", "egon-dev"); err != nil {
+			return nil, err
+		}
+	}
+
+	// Every build gets a new binary, as the previous one may still be
+	// running. They are all removed by Close.
+	binary := filepath.Join(r.tempDir, fmt.Sprintf("template%d", r.builds))
+	r.builds++
+	if err := r.build(path, binary); err != nil {
+		return nil, err
+	}
+
+	p := &program{modTime: info.ModTime(), binary: binary}
+	r.cache[path] = p
+	return p, nil
+}
+
+func (r *Renderer) goCommand() string {
+	if r.GoCommand != "" {
+		return r.GoCommand
+	}
+	return "go"
+}
@@ -0,0 +1,98 @@
+package dev_test
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/titpetric/egon/dev"
+)
+
+// Ensure that a template is rendered from source and rebuilt when it changes.
+func TestRenderer_Render(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go tool not available")
+	}
+
+	root := t.TempDir()
+	dir := filepath.Join(root, "views")
+	assert.NoError(t, os.Mkdir(dir, 0755))
+	writeModule(t, root)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "user.go"), []byte("package views\n\ntype User struct{ Name string }\n"), 0644))
+
+	path := filepath.Join(dir, "hello.egon")
+	assert.NoError(t, os.WriteFile(path, []byte(`<%! u *User %><%! n int %>Hello <%= u.Name %> <%= n %>`), 0644))
+
+	r := dev.NewRenderer(nil)
+	defer r.Close()
+
+	var buf bytes.Buffer
+	err := r.Render(&buf, path, map[string]string{"Name": "<b>"}, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello &lt;b&gt; 3", buf.String())
+
+	assert.NoError(t, os.WriteFile(path, []byte(`<%! u *User %><%! n int %>Bye <%= u.Name %>`), 0644))
+	later := time.Now().Add(time.Second)
+	assert.NoError(t, os.Chtimes(path, later, later))
+
+	buf.Reset()
+	err = r.View(path, map[string]string{"Name": "x"}, 1).Render(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "Bye x", buf.String())
+
+	_, err = os.Stat(filepath.Join(dir, "hello.egon.go"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+// Ensure that nothing is written when a template fails halfway through.
+func TestRenderer_RenderError(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go tool not available")
+	}
+
+	root := t.TempDir()
+	dir := filepath.Join(root, "views")
+	assert.NoError(t, os.Mkdir(dir, 0755))
+	writeModule(t, root)
+
+	path := filepath.Join(dir, "fail.egon")
+	src := `<%% import "errors" %%><%! n int %><% for i := 0; i < n; i++ { %>0123456789<% } %><% if n > 10 { return errors.New("too many") } %>`
+	assert.NoError(t, os.WriteFile(path, []byte(src), 0644))
+
+	r := dev.NewRenderer(nil)
+	defer r.Close()
+
+	var buf bytes.Buffer
+	assert.NoError(t, r.Render(&buf, path, 2))
+	assert.Equal(t, "01234567890123456789", buf.String())
+
+	// More output than the helper buffers is written before the error.
+	buf.Reset()
+	err := r.Render(&buf, path, 1000)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "too many")
+	}
+	assert.Equal(t, "", buf.String())
+}
+
+// writeModule writes the go.mod of a module at root that uses the egon
+// package of this source tree, which generated templates import.
+func writeModule(t *testing.T, root string) {
+	egon, err := filepath.Abs("..")
+	assert.NoError(t, err)
+	mod := "module example.com/app\n\n" +
+		"go 1.18\n\n" +
+		"require github.com/titpetric/egon v0.0.0\n\n" +
+		"replace github.com/titpetric/egon => " + strconv.Quote(egon) + "\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "go.mod"), []byte(mod), 0644))
+
+	// The go.sum of egon covers the modules it requires.
+	sum, err := os.ReadFile(filepath.Join(egon, "go.sum"))
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "go.sum"), sum, 0644))
+}
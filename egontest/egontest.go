@@ -0,0 +1,144 @@
+// Package egontest helps testing the output of generated templates against
+// golden files.
+//
+// A test renders a view or a template func, and compares the output with a
+// file in testdata, which is written instead when the tests are run with
+// -update. egontest doesn't define the flag, the test package does:
+//
+//	var _ = flag.Bool("update", false, "write the golden files")
+//
+//	func TestPage(t *testing.T) {
+//		out := egontest.Render(t, views.PageView(user))
+//		egontest.AssertHTML(t, out)
+//		egontest.Golden(t, "page", out, egontest.HTML)
+//	}
+package egontest
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/titpetric/egon"
+)
+
+// UpdateFlag is the flag that has Golden write the golden files. It is
+// looked up when Golden is called, so packages that don't define it are free
+// to use the name for something else.
+const UpdateFlag = "update"
+
+// UpdateEnv is the environment variable that has Golden write the golden
+// files when it is set to a true value, like "1", and UpdateFlag isn't
+// defined.
+const UpdateEnv = "EGONTEST_UPDATE"
+
+// updating returns whether UpdateFlag is set, or UpdateEnv if the flag isn't
+// defined.
+func updating() bool {
+	if f := flag.Lookup(UpdateFlag); f != nil {
+		update, _ := strconv.ParseBool(f.Value.String())
+		return update
+	}
+	update, _ := strconv.ParseBool(os.Getenv(UpdateEnv))
+	return update
+}
+
+// updateHint tells how to run the tests so that Golden writes the golden
+// files.
+func updateHint() string {
+	if flag.Lookup(UpdateFlag) != nil {
+		return "run the tests with -" + UpdateFlag + " to create it"
+	}
+	return fmt.Sprintf("run the tests with %s=1 to create it, or define the -%s flag in the test package: var _ = flag.Bool(%q, false, \"write the golden files\")", UpdateEnv, UpdateFlag, UpdateFlag)
+}
+
+// Render renders v and returns its output. Render errors fail the test.
+func Render(t testing.TB, v *egon.View) string {
+	t.Helper()
+	return RenderFunc(t, v.Render)
+}
+
+// RenderFunc calls render, usually a closure calling a template func, and
+// returns what it wrote. Errors fail the test.
+func RenderFunc(t testing.TB, render func(io.Writer) error) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := render(&buf); err != nil {
+		t.Fatalf("render: %s", err)
+	}
+	return buf.String()
+}
+
+// Normalizer rewrites output before it is compared, so that changes that
+// don't matter don't fail the test.
+type Normalizer func(string) string
+
+// TrimLines trims the whitespace around every line, and drops empty lines.
+func TrimLines(s string) string {
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+var (
+	spaces      = regexp.MustCompile(`\s+`)
+	betweenTags = regexp.MustCompile(`>\s*<`)
+)
+
+// CollapseSpace replaces every run of whitespace with a single space.
+func CollapseSpace(s string) string {
+	return spaces.ReplaceAllString(s, " ")
+}
+
+// HTML minifies HTML like generate --minify, and puts every tag that
+// follows another one on a line of its own, so golden files stay readable
+// and diff well. Whitespace between tags is ignored.
+func HTML(s string) string {
+	s = egon.NewMinifier().Minify(s)
+	s = betweenTags.ReplaceAllString(s, ">\n<")
+	return TrimLines(s)
+}
+
+// Golden compares got, after applying the normalizers, with the golden file
+// testdata/name.golden. When the tests are run with -update, or with
+// UpdateEnv set if the flag isn't defined, the golden file is written
+// instead.
+func Golden(t testing.TB, name, got string, normalize ...Normalizer) bool {
+	t.Helper()
+	for _, n := range normalize {
+		got = n(got)
+	}
+
+	path := filepath.Join("testdata", name+".golden")
+	if updating() {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return true
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Errorf("%s, %s", err, updateHint())
+		return false
+	}
+	return assert.Equal(t, string(want), got, "output differs from %s", path)
+}
@@ -0,0 +1,134 @@
+package egontest_test
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/titpetric/egon"
+	"github.com/titpetric/egon/egontest"
+)
+
+// recorder records the failures of a test instead of failing it.
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func pageView(name string) *egon.View {
+	return &egon.View{RenderFunc: func(w io.Writer) error {
+		_, err := fmt.Fprintf(w, "<ul>\n    <li class=\"user\">  %s  </li>\n\n</ul>\n", name)
+		return err
+	}}
+}
+
+// Ensure that rendered output is compared with the golden file after it is
+// normalised.
+func TestGolden(t *testing.T) {
+	out := egontest.Render(t, pageView("Ana"))
+	assert.True(t, egontest.Golden(t, "page", out, egontest.HTML))
+	if update, _ := strconv.ParseBool(os.Getenv(egontest.UpdateEnv)); update {
+		return
+	}
+
+	r := &recorder{TB: t}
+	assert.False(t, egontest.Golden(r, "page", egontest.Render(t, pageView("Bob")), egontest.HTML))
+	assert.Len(t, r.errors, 1)
+
+	r = &recorder{TB: t}
+	assert.False(t, egontest.Golden(r, "missing", out))
+	if assert.Len(t, r.errors, 1) {
+		assert.Contains(t, r.errors[0], egontest.UpdateEnv+"=1")
+		assert.Contains(t, r.errors[0], `flag.Bool("update", false, "write the golden files")`)
+	}
+}
+
+// Ensure that the -update flag of the test package writes the golden files,
+// and takes precedence over the environment.
+func TestGolden_UpdateFlag(t *testing.T) {
+	commandLine := flag.CommandLine
+	defer func() { flag.CommandLine = commandLine }()
+	flag.CommandLine = flag.NewFlagSet("test", flag.ContinueOnError)
+	update := flag.Bool("update", false, "write the golden files")
+
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(t.TempDir()))
+	defer os.Chdir(wd)
+
+	*update = true
+	assert.True(t, egontest.Golden(t, "page", "<p>Ana</p>\n"))
+	golden, err := os.ReadFile(filepath.Join("testdata", "page.golden"))
+	assert.NoError(t, err)
+	assert.Equal(t, "<p>Ana</p>\n", string(golden))
+
+	*update = false
+	t.Setenv(egontest.UpdateEnv, "1")
+	r := &recorder{TB: t}
+	assert.False(t, egontest.Golden(r, "page", "<p>Bob</p>\n"))
+	assert.Len(t, r.errors, 1)
+
+	r = &recorder{TB: t}
+	assert.False(t, egontest.Golden(r, "missing", "<p>Ana</p>\n"))
+	if assert.Len(t, r.errors, 1) {
+		assert.Contains(t, r.errors[0], "run the tests with -update to create it")
+	}
+}
+
+// Ensure that no flags are defined, so a test package importing egontest
+// can define an -update flag of its own.
+func TestNoFlags(t *testing.T) {
+	assert.Nil(t, flag.Lookup("update"))
+}
+
+// Ensure that the normalizers only remove differences in whitespace.
+func TestNormalizers(t *testing.T) {
+	s := "  <p>\n\n\t a  b </p>  \n"
+	assert.Equal(t, "<p>\na  b </p>\n", egontest.TrimLines(s))
+	assert.Equal(t, " <p> a b </p> ", egontest.CollapseSpace(s))
+	assert.Equal(t, "<p>\n<b>x</b>\n</p>\n", egontest.HTML("<p>\n  <b>x</b>\n</p>"))
+}
+
+// Ensure that badly formed HTML is reported with the line of the problem.
+func TestCheckHTML(t *testing.T) {
+	valid := []string{
+		"<!DOCTYPE html>\n<html><head><meta charset=utf-8></head><body></body></html>",
+		"<p class=\"a\" hidden data-x='1'>a < b<br><img src=x.png /></p>",
+		"<!-- <p> --><script>if (a < b && '</p>') {}</script>",
+	}
+	for _, s := range valid {
+		assert.NoError(t, egontest.CheckHTML(s), s)
+	}
+
+	invalid := map[string]string{
+		"<div>\n<p>\n</div>":   "line 3: </div> closes <p> from line 2",
+		"<div>\n<p></p>":       "line 1: <div> isn't closed",
+		"</p>":                 "line 1: </p> without a start tag",
+		"<a href=\"x>link</a>": "line 1: <a>: unterminated value of attribute href",
+		"<a id=1 id=2></a>":    "line 1: <a>: attribute id given twice",
+		"<p>\n<!-- x":          "line 2: unterminated comment",
+		"<script>alert(1)":     "line 1: <script> isn't closed",
+		"<input type=\"text\"": "line 1: <input>: unterminated tag",
+	}
+	for s, msg := range invalid {
+		err := egontest.CheckHTML(s)
+		if assert.Error(t, err, s) {
+			assert.Equal(t, msg, err.Error(), s)
+		}
+	}
+
+	r := &recorder{TB: t}
+	assert.False(t, egontest.AssertHTML(r, "<p>"))
+	assert.Equal(t, []string{"invalid HTML: line 1: <p> isn't closed"}, r.errors)
+}
@@ -0,0 +1,188 @@
+package egontest
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// voidElements are the elements that have no end tag.
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true,
+	"hr": true, "img": true, "input": true, "link": true, "meta": true,
+	"param": true, "source": true, "track": true, "wbr": true,
+}
+
+// rawTextElements are the elements whose content isn't parsed as HTML.
+var rawTextElements = map[string]bool{
+	"script": true, "style": true, "textarea": true, "title": true,
+}
+
+// CheckHTML returns an error describing the first problem that makes s
+// badly formed HTML: elements that aren't closed, or closed out of order,
+// end tags without a start tag, unterminated tags, comments and attribute
+// values, and attributes given twice. Void elements need no end tag, and
+// the content of raw text elements like script isn't checked.
+func CheckHTML(s string) error {
+	type element struct {
+		name string
+		line int
+	}
+	var open []element
+
+	line := func(i int) int { return strings.Count(s[:i], "\n") + 1 }
+	for i := 0; i < len(s); {
+		j := strings.IndexByte(s[i:], '<')
+		if j < 0 {
+			break
+		}
+		i += j
+		start := i
+
+		switch {
+		case strings.HasPrefix(s[i:], "<!--"):
+			end := strings.Index(s[i+4:], "-->")
+			if end < 0 {
+				return fmt.Errorf("line %d: unterminated comment", line(start))
+			}
+			i += 4 + end + 3
+		case strings.HasPrefix(s[i:], "<!"), strings.HasPrefix(s[i:], "<?"):
+			end := strings.IndexByte(s[i:], '>')
+			if end < 0 {
+				return fmt.Errorf("line %d: unterminated declaration", line(start))
+			}
+			i += end + 1
+		case strings.HasPrefix(s[i:], "</"):
+			name, n := tagName(s[i+2:])
+			if name == "" {
+				return fmt.Errorf("line %d: invalid end tag", line(start))
+			}
+			i += 2 + n
+			end := strings.IndexByte(s[i:], '>')
+			if end < 0 || strings.TrimSpace(s[i:i+end]) != "" {
+				return fmt.Errorf("line %d: unterminated end tag </%s>", line(start), name)
+			}
+			i += end + 1
+			if len(open) == 0 {
+				return fmt.Errorf("line %d: </%s> without a start tag", line(start), name)
+			}
+			if last := open[len(open)-1]; last.name != name {
+				return fmt.Errorf("line %d: </%s> closes <%s> from line %d", line(start), name, last.name, last.line)
+			}
+			open = open[:len(open)-1]
+		default:
+			name, n := tagName(s[i+1:])
+			if name == "" {
+				// A "<" that doesn't start a tag is text.
+				i++
+				continue
+			}
+			i += 1 + n
+			n, selfClosing, err := attributes(s[i:])
+			if err != nil {
+				return fmt.Errorf("line %d: <%s>: %s", line(start), name, err)
+			}
+			i += n
+			if selfClosing || voidElements[name] {
+				continue
+			}
+			if rawTextElements[name] {
+				end := strings.Index(strings.ToLower(s[i:]), "</"+name)
+				if end < 0 {
+					return fmt.Errorf("line %d: <%s> isn't closed", line(start), name)
+				}
+				i += end
+			}
+			open = append(open, element{name, line(start)})
+		}
+	}
+	if len(open) > 0 {
+		last := open[len(open)-1]
+		return fmt.Errorf("line %d: <%s> isn't closed", last.line, last.name)
+	}
+	return nil
+}
+
+// tagName returns the lower case name of the tag at the start of s, and
+// its length.
+func tagName(s string) (string, int) {
+	n := 0
+	for n < len(s) && (isLetter(s[n]) || n > 0 && (s[n] == '-' || '0' <= s[n] && s[n] <= '9')) {
+		n++
+	}
+	return strings.ToLower(s[:n]), n
+}
+
+// attributes reads the attributes of a start tag up to and including its
+// closing ">", and returns their length and whether the tag ends in "/>".
+func attributes(s string) (int, bool, error) {
+	seen := map[string]bool{}
+	i := 0
+	for {
+		for i < len(s) && isSpace(s[i]) {
+			i++
+		}
+		switch {
+		case i == len(s):
+			return 0, false, fmt.Errorf("unterminated tag")
+		case s[i] == '>':
+			return i + 1, false, nil
+		case strings.HasPrefix(s[i:], "/>"):
+			return i + 2, true, nil
+		}
+
+		start := i
+		for i < len(s) && !isSpace(s[i]) && s[i] != '=' && s[i] != '>' && !strings.HasPrefix(s[i:], "/>") {
+			if s[i] == '"' || s[i] == '\'' || s[i] == '<' {
+				return 0, false, fmt.Errorf("invalid attribute name %q", s[start:i+1])
+			}
+			i++
+		}
+		name := strings.ToLower(s[start:i])
+		if seen[name] {
+			return 0, false, fmt.Errorf("attribute %s given twice", name)
+		}
+		seen[name] = true
+
+		for i < len(s) && isSpace(s[i]) {
+			i++
+		}
+		if i == len(s) || s[i] != '=' {
+			continue
+		}
+		i++
+		for i < len(s) && isSpace(s[i]) {
+			i++
+		}
+		if i < len(s) && (s[i] == '"' || s[i] == '\'') {
+			end := strings.IndexByte(s[i+1:], s[i])
+			if end < 0 {
+				return 0, false, fmt.Errorf("unterminated value of attribute %s", name)
+			}
+			i += end + 2
+			continue
+		}
+		for i < len(s) && !isSpace(s[i]) && s[i] != '>' {
+			i++
+		}
+	}
+}
+
+func isLetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+// AssertHTML fails the test if s isn't well formed HTML, as checked by
+// CheckHTML.
+func AssertHTML(t testing.TB, s string) bool {
+	t.Helper()
+	if err := CheckHTML(s); err != nil {
+		t.Errorf("invalid HTML: %s", err)
+		return false
+	}
+	return true
+}
@@ -9,4 +9,29 @@ var (
 	// ErrUnidentifiablePackage notifies the user that the package name can't be
 	// determined
 	ErrUnidentifiablePackage = errors.New("package name cannot be determined")
+
+	// ErrDelimsFormat notifies the user that a delims directive is poorly
+	// formatted.
+	ErrDelimsFormat = errors.New("delims directive should be of form `egon:delims open close`")
+
+	// ErrTranslationFormat notifies the user that a translation block is
+	// poorly formatted.
+	ErrTranslationFormat = errors.New("translation blocks should be of form `\"message\" name=value ...`")
+
+	// ErrRenderContext notifies the user that a template with translation
+	// blocks or locale format codes has no render context to find the
+	// translator and the locale in.
+	ErrRenderContext = errors.New("translation blocks and locale format codes need a context.Context or *http.Request parameter")
+
+	// ErrDirectiveFormat notifies the user that a directive block is unknown
+	// or poorly formatted.
+	ErrDirectiveFormat = errors.New("directives should be of form `filter name func`, `filters [name] \"path\"`, `component Name [name=value ...] [/]`, `end` or `children`")
+
+	// ErrUnclosedComponent notifies the user that a component block has no
+	// matching end block.
+	ErrUnclosedComponent = errors.New("component block is missing an end block")
+
+	// ErrUnmatchedEnd notifies the user that an end block has no component
+	// block to close.
+	ErrUnmatchedEnd = errors.New("end block without a component block")
 )
@@ -0,0 +1,254 @@
+package egon
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// filter is a filter declared by a directive: the Go func it calls, and the
+// import the func needs, if any.
+type filter struct {
+	fn   string
+	spec string // import spec, e.g. `"strings"`
+}
+
+// filters returns the filters declared by the directives of the template,
+// by name. Later declarations replace earlier ones.
+func (t *Template) filters() (map[string]filter, error) {
+	filters := map[string]filter{}
+	for _, b := range t.Blocks {
+		d, ok := b.(*DirectiveBlock)
+		if !ok {
+			continue
+		}
+		switch d.Name {
+		case "filter":
+			filters[d.Args[0]] = filter{fn: d.Args[1]}
+		case "filters":
+			path, _ := strconv.Unquote(d.Args[len(d.Args)-1])
+			name, funcs, err := filterPackage(path, t.Path)
+			if err != nil {
+				return nil, scanError(d.Pos, fmt.Errorf("filters %q: %s", path, err))
+			}
+			spec := strconv.Quote(path)
+			if len(d.Args) == 2 {
+				name = d.Args[0]
+				spec = name + " " + spec
+			}
+			for _, fn := range funcs {
+				filters[lowerFirst(fn)] = filter{fn: name + "." + fn, spec: spec}
+			}
+		}
+	}
+	return filters, nil
+}
+
+// filterPackage returns the name of the package at the import path, as
+// imported by the template at tmplPath, and its exported funcs.
+func filterPackage(path, tmplPath string) (string, []string, error) {
+	dir, err := filepath.Abs(filepath.Dir(tmplPath))
+	if err != nil {
+		return "", nil, err
+	}
+	pkg, err := build.Import(path, dir, 0)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var funcs []string
+	fset := token.NewFileSet()
+	for _, name := range pkg.GoFiles {
+		f, err := parser.ParseFile(fset, filepath.Join(pkg.Dir, name), nil, 0)
+		if err != nil {
+			return "", nil, err
+		}
+		for _, decl := range f.Decls {
+			if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil && fn.Name.IsExported() {
+				funcs = append(funcs, fn.Name.Name)
+			}
+		}
+	}
+	return pkg.Name, funcs, nil
+}
+
+// lowerFirst returns s with its first letter in lower case.
+func lowerFirst(s string) string {
+	r, n := utf8.DecodeRuneInString(s)
+	return string(unicode.ToLower(r)) + s[n:]
+}
+
+// applyFilters returns blocks with the pipes of print and raw print blocks
+// replaced by calls to the filters they name. The blocks with pipes are
+// copied.
+func applyFilters(blocks []Block, filters map[string]filter) []Block {
+	if len(filters) == 0 {
+		return blocks
+	}
+	out := make([]Block, len(blocks))
+	for i, b := range blocks {
+		out[i] = b
+		switch b := b.(type) {
+		case *PrintBlock:
+			if expr, imports, ok := pipeExpr(b.Content, filters); ok {
+				c := *b
+				c.Content, c.imports = expr, imports
+				out[i] = &c
+			}
+		case *RawPrintBlock:
+			if expr, imports, ok := pipeExpr(b.Content, filters); ok {
+				c := *b
+				c.Content, c.imports = expr, imports
+				out[i] = &c
+			}
+		}
+	}
+	return out
+}
+
+// exprToken is a token of the Go source in a block, from offset to end.
+type exprToken struct {
+	offset, end int
+	tok         token.Token
+	lit         string
+}
+
+// pipeExpr rewrites an expression with pipes, e.g. "u.Bio | truncate 80 |
+// upper", into nested filter calls, e.g. "filters.Upper(filters.Truncate(
+// u.Bio, 80))", and returns the imports of the filters used. A "|" followed
+// by a name that isn't a filter is kept as Go's bitwise or. It returns false
+// if expr has no pipes.
+func pipeExpr(expr string, filters map[string]filter) (string, []string, bool) {
+	expr = printExpr(expr)
+	toks := exprTokens(expr)
+
+	// Split the expression at the "|" outside of brackets.
+	var (
+		segments [][]exprToken
+		starts   = []int{0}
+		depth    int
+		last     int
+	)
+	for i, t := range toks {
+		switch t.tok {
+		case token.LPAREN, token.LBRACK, token.LBRACE:
+			depth++
+		case token.RPAREN, token.RBRACK, token.RBRACE:
+			depth--
+		case token.OR:
+			if depth == 0 {
+				segments = append(segments, toks[last:i])
+				starts = append(starts, t.end)
+				last = i + 1
+			}
+		}
+	}
+	segments = append(segments, toks[last:])
+	if len(segments) == 1 {
+		return "", nil, false
+	}
+
+	var (
+		out     = strings.TrimSpace(expr[:segmentEnd(expr, starts, 0)])
+		imports []string
+		piped   bool
+	)
+	for i, seg := range segments[1:] {
+		text := expr[starts[i+1]:segmentEnd(expr, starts, i+1)]
+		f, ok := filters[filterName(seg)]
+		if !ok {
+			out += " |" + strings.TrimRight(text, " \t\n")
+			continue
+		}
+		args := []string{out}
+		for _, arg := range filterArgs(seg[1:]) {
+			args = append(args, expr[arg[0]:arg[1]])
+		}
+		out = f.fn + "(" + strings.Join(args, ", ") + ")"
+		if f.spec != "" {
+			imports = append(imports, f.spec)
+		}
+		piped = true
+	}
+	return out, imports, piped
+}
+
+// segmentEnd returns the offset the i-th segment of expr ends at, before
+// the "|" following it.
+func segmentEnd(expr string, starts []int, i int) int {
+	if i+1 < len(starts) {
+		return starts[i+1] - 1
+	}
+	return len(expr)
+}
+
+// filterName returns the name of the filter a pipe segment calls, or "" if
+// the segment doesn't start with a name followed by a space or nothing.
+// Names may be Go keywords, like default.
+func filterName(seg []exprToken) string {
+	if len(seg) == 0 || seg[0].tok != token.IDENT && !seg[0].tok.IsKeyword() {
+		return ""
+	}
+	if len(seg) > 1 && seg[1].offset == seg[0].end {
+		return ""
+	}
+	return seg[0].lit
+}
+
+// filterArgs returns the start and end offsets of the arguments of a
+// filter, which are separated by spaces outside of brackets.
+func filterArgs(toks []exprToken) [][2]int {
+	var (
+		args  [][2]int
+		depth int
+	)
+	for i, t := range toks {
+		if depth == 0 && (i == 0 || t.offset > toks[i-1].end) {
+			args = append(args, [2]int{t.offset, t.end})
+		} else {
+			args[len(args)-1][1] = t.end
+		}
+		switch t.tok {
+		case token.LPAREN, token.LBRACK, token.LBRACE:
+			depth++
+		case token.RPAREN, token.RBRACK, token.RBRACE:
+			depth--
+		}
+	}
+	return args
+}
+
+// exprTokens returns the tokens of expr, without the semicolons inserted
+// at newlines.
+func exprTokens(expr string) []exprToken {
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(expr))
+	var s scanner.Scanner
+	s.Init(file, []byte(expr), nil, 0)
+
+	var toks []exprToken
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if tok == token.SEMICOLON && lit == "\n" {
+			continue
+		}
+		offset := file.Offset(pos)
+		length := len(lit)
+		if lit == "" {
+			length = len(tok.String())
+		}
+		toks = append(toks, exprToken{offset: offset, end: offset + length, tok: tok, lit: lit})
+	}
+	return toks
+}
@@ -0,0 +1,94 @@
+package egon_test
+
+import (
+	"bytes"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	. "github.com/titpetric/egon"
+)
+
+// Ensure that a directive block can be scanned.
+func TestScannerDirectiveBlock(t *testing.T) {
+	s := NewScanner(bytes.NewBufferString(`<%@ filter upper strings.ToUpper %>`), "tmpl.egon")
+	b, err := s.Scan()
+	assert.NoError(t, err)
+	if b, ok := b.(*DirectiveBlock); assert.True(t, ok) {
+		assert.Equal(t, "filter", b.Name)
+		assert.Equal(t, []string{"upper", "strings.ToUpper"}, b.Args)
+	}
+}
+
+// Ensure that unknown and badly formed directives return an error.
+func TestScannerDirectiveBlockFormat(t *testing.T) {
+	for _, src := range []string{`<%@ %>`, `<%@ include "a" %>`, `<%@ filter upper %>`, `<%@ filter upper "%>`, `<%@ filter a.b f %>`, `<%@ filters path %>`} {
+		_, err := NewScanner(bytes.NewBufferString(src), "tmpl.egon").Scan()
+		assert.Equal(t, ErrDirectiveFormat, err, src)
+	}
+}
+
+// Ensure that pipes are written as nested calls of the filters declared
+// by directives, and that other uses of "|" are kept.
+func TestTemplate_WriteFilters(t *testing.T) {
+	src := "<%% import \"strings\" %%>" +
+		"<%@ filter upper strings.ToUpper %>" +
+		"<%@ filter truncate truncate %>" +
+		"<%@ filter join strings.Join %>" +
+		"<%@ filter default orDefault %>" +
+		"<%= u.Bio | truncate 80 | upper %>" +
+		"<%== tags | join \", \" %>" +
+		"<%=d a | b %>" +
+		"<%= s | truncate (n + 1) | upper | x %>" +
+		"<%= f(a | b) | upper %>" +
+		"<%= s | default \"-\" %>"
+	tmpl, err := ParseConfig(strings.NewReader(src), "/tmp/views/filters.egon", &Config{StringOptimisations: true})
+	assert.NoError(t, err)
+
+	out := tmpl.String()
+	assert.Contains(t, out, "egon.Print(w, strings.ToUpper(truncate(u.Bio, 80)))")
+	assert.Contains(t, out, `io.WriteString(w, strings.Join(tags, ", "))`)
+	assert.Contains(t, out, "egon.AppendInt(egonScratch.B[:0], a | b )")
+	assert.Contains(t, out, "egon.Print(w, strings.ToUpper(truncate(s, (n + 1))) | x)")
+	assert.Contains(t, out, "egon.Print(w, strings.ToUpper(f(a | b)))")
+	assert.Contains(t, out, `egon.Print(w, orDefault(s, "-"))`)
+	_, err = parser.ParseFile(token.NewFileSet(), "filters.egon.go", out, 0)
+	assert.NoError(t, err)
+}
+
+// Ensure that the exported funcs of a package are declared as filters, and
+// that the package is imported when they are used.
+func TestTemplate_WriteFiltersPackage(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "views")
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "text"), 0755))
+	pkg := "package text\n\nfunc ToUpper(s string) string { return s }\n\nfunc (t T) Method() {}\n\nfunc lower() {}\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "text", "text.go"), []byte(pkg), 0644))
+
+	tmpl, err := Parse(strings.NewReader(`<%@ filters "./text" %><%= s | toUpper %><%= s | method %>`), filepath.Join(dir, "page.egon"))
+	assert.NoError(t, err)
+	out := tmpl.String()
+	assert.Contains(t, out, "\"./text\"\n")
+	assert.Contains(t, out, "egon.Print(w, text.ToUpper(s))")
+	assert.Contains(t, out, "egon.Print(w,  s | method )")
+
+	tmpl, err = Parse(strings.NewReader(`<%@ filters t "./text" %><%= s %><%= s | toUpper %>`), filepath.Join(dir, "page.egon"))
+	assert.NoError(t, err)
+	out = tmpl.String()
+	assert.Contains(t, out, "t \"./text\"\n")
+	assert.Contains(t, out, "egon.Print(w, t.ToUpper(s))")
+
+	tmpl, err = Parse(strings.NewReader(`<%@ filters "./text" %><%= s %>`), filepath.Join(dir, "page.egon"))
+	assert.NoError(t, err)
+	assert.NotContains(t, tmpl.String(), "./text")
+
+	tmpl, err = Parse(strings.NewReader("\n<%@ filters \"./missing\" %>"), filepath.Join(dir, "page.egon"))
+	assert.NoError(t, err)
+	err = tmpl.Write(&bytes.Buffer{})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `page.egon:2: filters "./missing"`)
+	}
+}
@@ -0,0 +1,84 @@
+// Package filters holds common filters for the pipes of print blocks. A
+// template declares them with a directive, and calls them by their names
+// with a lower case first letter:
+//
+//	<%@ filters "github.com/titpetric/egon/filters" %>
+//	<p><%= u.Bio | truncate 80 | upper %></p>
+package filters
+
+import (
+	"html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/titpetric/egon"
+)
+
+// Upper returns s in upper case.
+func Upper(s string) string {
+	return strings.ToUpper(s)
+}
+
+// Lower returns s in lower case.
+func Lower(s string) string {
+	return strings.ToLower(s)
+}
+
+// Title returns s with the first letter of every word in upper case.
+func Title(s string) string {
+	prev := ' '
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(prev) {
+			r = unicode.ToTitle(r)
+		}
+		prev = r
+		return r
+	}, s)
+}
+
+// Trim returns s without leading and trailing white space.
+func Trim(s string) string {
+	return strings.TrimSpace(s)
+}
+
+// Truncate returns s cut to n runes, ending in "…" if it was longer.
+func Truncate(s string, n int) string {
+	if n < 0 || utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	if n == 0 {
+		return ""
+	}
+	i := 0
+	for j := range s {
+		if i == n-1 {
+			return strings.TrimRightFunc(s[:j], unicode.IsSpace) + "…"
+		}
+		i++
+	}
+	return s
+}
+
+// Default returns def if s is empty.
+func Default(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
+
+// Join returns the elements of a joined with sep.
+func Join(a []string, sep string) string {
+	return strings.Join(a, sep)
+}
+
+// Replace returns s with every old replaced by new.
+func Replace(s, old, new string) string {
+	return strings.Replace(s, old, new, -1)
+}
+
+// Nl2br returns s HTML escaped, with "<br>" before its newlines.
+func Nl2br(s string) egon.HTML {
+	return egon.HTML(strings.Replace(html.EscapeString(s), "\n", "<br>\n", -1))
+}
@@ -0,0 +1,33 @@
+package filters_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/titpetric/egon"
+	"github.com/titpetric/egon/filters"
+)
+
+// Ensure that strings are truncated to a number of runes.
+func TestTruncate(t *testing.T) {
+	assert.Equal(t, "héllo", filters.Truncate("héllo", 5))
+	assert.Equal(t, "hé…", filters.Truncate("héllo", 3))
+	assert.Equal(t, "a…", filters.Truncate("a bc", 3))
+	assert.Equal(t, "", filters.Truncate("abc", 0))
+}
+
+// Ensure that the first letters of words are put in upper case.
+func TestTitle(t *testing.T) {
+	assert.Equal(t, "Hello Wide  World", filters.Title("hello wide  world"))
+}
+
+// Ensure that newlines are turned into line breaks of escaped text.
+func TestNl2br(t *testing.T) {
+	assert.Equal(t, egon.HTML("a &lt;b&gt;<br>\nc"), filters.Nl2br("a <b>\nc"))
+}
+
+// Ensure that empty strings are replaced by a default.
+func TestDefault(t *testing.T) {
+	assert.Equal(t, "n/a", filters.Default("", "n/a"))
+	assert.Equal(t, "x", filters.Default("x", "n/a"))
+}
@@ -0,0 +1,303 @@
+package egon
+
+import (
+	"bytes"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Format returns the canonical form of the template src, read from path.
+//
+// Print, raw print, translation, directive and parameter blocks are written
+// with a single space inside their delimiters, and the Go code in print and
+// code blocks is formatted with gofmt. Code that doesn't parse on its own is left as it is.
+// Closing braces of code blocks opened with "<%-" are indented like the
+// line that opened the brace. Text, comments and header blocks aren't
+// changed.
+func Format(src []byte, path string, config *Config) ([]byte, error) {
+	var (
+		s      = NewScannerConfig(bytes.NewReader(src), path, config)
+		out    bytes.Buffer
+		indent []string // indentation of the lines that opened the braces
+	)
+	for {
+		pos, delims := s.pos, s.Delims()
+		b, err := s.Scan()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, scanError(pos, err)
+		}
+
+		if b, ok := b.(*CodeBlock); ok {
+			closed, opened := braceBalance(b.Content)
+			line := currentLine(out.Bytes())
+			if b.TrimLeft && strings.TrimLeft(line, " \t") == "" && closed > 0 && closed <= len(indent) {
+				out.Truncate(out.Len() - len(line))
+				out.WriteString(indent[len(indent)-closed])
+				line = indent[len(indent)-closed]
+			}
+			if closed > len(indent) {
+				closed = len(indent)
+			}
+			indent = indent[:len(indent)-closed]
+			for i := 0; i < opened; i++ {
+				indent = append(indent, line[:len(line)-len(strings.TrimLeft(line, " \t"))])
+			}
+		}
+		formatBlock(&out, b, delims)
+	}
+	return out.Bytes(), nil
+}
+
+// formatBlock writes b to buf in its canonical form, using the delimiters d.
+func formatBlock(buf *bytes.Buffer, b Block, d Delims) {
+	switch b := b.(type) {
+	case *TextBlock:
+		if b.Raw {
+			buf.WriteString(d.Open + "raw" + d.Close + b.Content + d.Open + "endraw" + d.Close)
+		} else {
+			buf.WriteString(b.Content)
+		}
+	case *CommentBlock:
+		writeDelims(buf, d, "#", b.Content, "#", b.TrimLeft, b.TrimRight)
+	case *HeaderBlock:
+		writeDelims(buf, d, "%", b.Content, "%", b.TrimLeft, b.TrimRight)
+	case *ParameterBlock:
+		paramType, ok := formatExpr(b.ParamType)
+		if !ok {
+			paramType = b.ParamType
+		}
+		writeDelims(buf, d, "!", " "+b.ParamName+" "+paramType+" ", "", b.TrimLeft, b.TrimRight)
+	case *PrintBlock:
+		open := "=" + printFormat(b)
+		if expr, ok := formatExpr(b.Content); ok {
+			writeDelims(buf, d, open, " "+expr+" ", "", b.TrimLeft, b.TrimRight)
+		} else {
+			writeDelims(buf, d, open, formatPrefix(b)+b.Content, "", b.TrimLeft, b.TrimRight)
+		}
+	case *RawPrintBlock:
+		content, ok := formatExpr(b.Content)
+		if ok {
+			content = " " + content + " "
+		} else {
+			content = b.Content
+		}
+		writeDelims(buf, d, "==", content, "", b.TrimLeft, b.TrimRight)
+	case *DirectiveBlock:
+		writeDelims(buf, d, "@", " "+strings.Join(append([]string{b.Name}, b.Args...), " ")+" ", "", b.TrimLeft, b.TrimRight)
+	case *ComponentBlock:
+		if content, ok := formatComponent(b); ok {
+			writeDelims(buf, d, "@", " "+content+" ", "", b.TrimLeft, b.TrimRight)
+		} else {
+			writeDelims(buf, d, "@", b.Content, "", b.TrimLeft, b.TrimRight)
+		}
+	case *EndBlock:
+		writeDelims(buf, d, "@", " end ", "", b.TrimLeft, b.TrimRight)
+	case *TranslateBlock:
+		if content, ok := formatTranslation(b); ok {
+			writeDelims(buf, d, "t", " "+content+" ", "", b.TrimLeft, b.TrimRight)
+		} else {
+			writeDelims(buf, d, "t", b.Content, "", b.TrimLeft, b.TrimRight)
+		}
+	case *CodeBlock:
+		content, ok := formatStmts(b.Content)
+		switch {
+		case !ok:
+			content = b.Content
+		case strings.Contains(content, "\n"):
+			content = "\n" + content + "\n"
+		case content == "":
+			content = " "
+		default:
+			content = " " + content + " "
+		}
+		writeDelims(buf, d, "", content, "", b.TrimLeft, b.TrimRight)
+	}
+}
+
+// writeDelims writes a block with its content between the delimiters d,
+// adding the markers of the block type and the trim markers.
+func writeDelims(buf *bytes.Buffer, d Delims, open, content, close string, trimLeft, trimRight bool) {
+	buf.WriteString(d.Open)
+	if trimLeft {
+		buf.WriteByte('-')
+	}
+	buf.WriteString(open)
+	buf.WriteString(content)
+	if trimRight {
+		buf.WriteByte('-')
+	}
+	buf.WriteString(close)
+	buf.WriteString(d.Close)
+}
+
+// printFormat returns the format code of a print block as it is written
+// after "=".
+func printFormat(b *PrintBlock) string {
+	switch {
+	case b.Type == 0:
+		return ""
+	case b.Precision >= 0:
+		return string(b.Type) + "." + strconv.Itoa(b.Precision)
+	}
+	return string(b.Type)
+}
+
+// formatPrefix returns the space the scanner removed after the format code
+// of a print block.
+func formatPrefix(b *PrintBlock) string {
+	if b.Type == 0 {
+		return ""
+	}
+	return " "
+}
+
+// formatTranslation returns the message and arguments of a translation
+// block, separated by single spaces. Blocks with comments are left as they
+// are.
+func formatTranslation(b *TranslateBlock) (string, bool) {
+	if strings.Contains(b.Content, "//") || strings.Contains(b.Content, "/*") {
+		return "", false
+	}
+	parts := []string{strconv.Quote(b.Message)}
+	if b.Plural != "" {
+		parts = append(parts, strconv.Quote(b.Plural))
+	}
+	return strings.Join(append(parts, formatArgs(b.Args)...), " "), true
+}
+
+// formatComponent returns the name and arguments of a component block,
+// separated by single spaces. Blocks with comments are left as they are.
+func formatComponent(b *ComponentBlock) (string, bool) {
+	if strings.Contains(b.Content, "//") || strings.Contains(b.Content, "/*") {
+		return "", false
+	}
+	parts := append([]string{"component", b.Name}, formatArgs(b.Args)...)
+	if b.SelfClosing {
+		parts = append(parts, "/")
+	}
+	return strings.Join(parts, " "), true
+}
+
+// formatArgs returns the name=expr arguments of a block, with their
+// expressions formatted.
+func formatArgs(args []NamedArg) []string {
+	parts := make([]string, len(args))
+	for i, arg := range args {
+		expr, ok := formatExpr(arg.Expr)
+		if !ok {
+			expr = arg.Expr
+		}
+		parts[i] = arg.Name + "=" + expr
+	}
+	return parts
+}
+
+// currentLine returns the last line of buf, without its newline.
+func currentLine(buf []byte) string {
+	return string(buf[bytes.LastIndexByte(buf, '\n')+1:])
+}
+
+// formatExpr formats the Go expression src with gofmt.
+func formatExpr(src string) (string, bool) {
+	if strings.Contains(src, "//") || strings.Contains(src, "/*") {
+		return "", false
+	}
+	expr, err := parser.ParseExpr(src)
+	if err != nil {
+		return "", false
+	}
+	var buf bytes.Buffer
+	if err := format.Node(&buf, token.NewFileSet(), expr); err != nil {
+		return "", false
+	}
+	return buf.String(), true
+}
+
+// formatStmts formats the Go statements src with gofmt. Braces closed or
+// left open by src are matched with placeholder statements while
+// formatting, so the fragments of control flow statements spread over
+// several code blocks can be formatted too.
+func formatStmts(src string) (string, bool) {
+	if strings.Contains(src, "`") {
+		return "", false
+	}
+	closed, opened := braceBalance(src)
+
+	var wrapped strings.Builder
+	wrapped.WriteString("package p\n\nfunc _() {\n")
+	wrapped.WriteString(strings.Repeat("if egonFmt {\n", closed))
+	wrapped.WriteString(strings.TrimSpace(src))
+	wrapped.WriteString("\n")
+	wrapped.WriteString(strings.Repeat("}\n", opened))
+	wrapped.WriteString("}\n")
+
+	out, err := format.Source([]byte(wrapped.String()))
+	if err != nil {
+		return "", false
+	}
+
+	// Strip the function and the placeholders, which gofmt keeps on lines
+	// of their own.
+	lines := strings.Split(strings.TrimSuffix(string(out), "\n"), "\n")
+	start := 3 + closed
+	end := len(lines) - 1 - opened
+	if start > end || lines[2] != "func _() {" {
+		return "", false
+	}
+	for _, line := range lines[3:start] {
+		if strings.TrimSpace(line) != "if egonFmt {" {
+			return "", false
+		}
+	}
+	for _, line := range lines[end : len(lines)-1] {
+		if strings.TrimSpace(line) != "}" {
+			return "", false
+		}
+	}
+	return dedent(lines[start:end]), true
+}
+
+// dedent joins lines, removing the tabs they all start with.
+func dedent(lines []string) string {
+	common := -1
+	for _, line := range lines {
+		if line == "" {
+			continue
+		}
+		n := len(line) - len(strings.TrimLeft(line, "\t"))
+		if common < 0 || n < common {
+			common = n
+		}
+	}
+	for i, line := range lines {
+		if len(line) >= common && common > 0 {
+			lines[i] = line[common:]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// braceBalance returns the number of braces the Go fragment src closes
+// without opening them, and the number it opens without closing them.
+func braceBalance(src string) (closed, opened int) {
+	toks, _ := goTokens(src)
+	depth := 0
+	for _, tok := range toks {
+		switch tok {
+		case token.LBRACE:
+			depth++
+		case token.RBRACE:
+			depth--
+			if -depth > closed {
+				closed = -depth
+			}
+		}
+	}
+	return closed, depth + closed
+}
@@ -0,0 +1,118 @@
+package egon_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	. "github.com/titpetric/egon"
+)
+
+func format(t *testing.T, src string) string {
+	out, err := Format([]byte(src), "tmp.egon", &Config{StringOptimisations: true})
+	assert.NoError(t, err)
+	return string(out)
+}
+
+// Ensure that blocks are spaced and their Go code formatted.
+func TestFormat(t *testing.T) {
+	src := "<%%import \"strings\"%%>\n" +
+		"<%!   items   []  string%>\n" +
+		"<%#keep   this#%>\n" +
+		"<%for _,item:=range items{%>\n" +
+		"<li><%=strings.ToUpper( item )%> <%=d len(item)%> <%=f.2 1.0/3%> <%==\"<hr>\"%></li>\n" +
+		"<%}%>\n"
+	want := "<%%import \"strings\"%%>\n" +
+		"<%! items []string %>\n" +
+		"<%#keep   this#%>\n" +
+		"<% for _, item := range items { %>\n" +
+		"<li><%= strings.ToUpper(item) %> <%=d len(item) %> <%=f.2 1.0 / 3 %> <%== \"<hr>\" %></li>\n" +
+		"<% } %>\n"
+	assert.Equal(t, want, format(t, src))
+	assert.Equal(t, want, format(t, want))
+}
+
+// Ensure that trim markers are kept.
+func TestFormat_TrimMarkers(t *testing.T) {
+	src := "<%-if ok{-%>\n<%-= x-%><%-== y -%><%-# c -#%><%-! p int-%>\n<%-} else {-%>\n<%-}-%>\n"
+	want := "<%- if ok { -%>\n<%-= x -%><%-== y -%><%-# c -#%><%-! p int -%>\n<%- } else { -%>\n<%- } -%>\n"
+	assert.Equal(t, want, format(t, src))
+}
+
+// Ensure that code which doesn't parse is kept as it is.
+func TestFormat_Invalid(t *testing.T) {
+	src := "<% switch x { %><%case 1:%><%= a b %><%=d  x y%><% } %>"
+	want := "<% switch x { %><%case 1:%><%= a b %><%=d  x y%><% } %>"
+	assert.Equal(t, want, format(t, src))
+}
+
+// Ensure that multi-line code blocks are formatted over several lines.
+func TestFormat_MultiLine(t *testing.T) {
+	src := "<%\n  a:=1\n  if a>0 {\n  a++\n  }\n%>"
+	want := "<%\na := 1\nif a > 0 {\n\ta++\n}\n%>"
+	assert.Equal(t, want, format(t, src))
+}
+
+// Ensure that closing braces opened with "<%-" are indented like the line
+// that opened them.
+func TestFormat_Indent(t *testing.T) {
+	src := "<ul>\n" +
+		"  <%- for _, x := range xs { -%>\n" +
+		"    <%- if x { -%>\n" +
+		"  <li></li>\n" +
+		"<%- } else { -%>\n" +
+		"        <%- } -%>\n" +
+		"<%- } -%>\n" +
+		"</ul>\n"
+	want := "<ul>\n" +
+		"  <%- for _, x := range xs { -%>\n" +
+		"    <%- if x { -%>\n" +
+		"  <li></li>\n" +
+		"    <%- } else { -%>\n" +
+		"    <%- } -%>\n" +
+		"  <%- } -%>\n" +
+		"</ul>\n"
+	assert.Equal(t, want, format(t, src))
+}
+
+// Ensure that scanning errors are returned.
+func TestFormat_Error(t *testing.T) {
+	_, err := Format([]byte("<p>\n<%= x"), "tmp.egon", nil)
+	assert.EqualError(t, err, "tmp.egon:2: unexpected EOF")
+}
+
+// Ensure that templates are formatted with their own delimiters.
+func TestFormat_Delims(t *testing.T) {
+	src := "<%#egon:delims {% %}#%>\n<%=x%>{%=x%}{%-#c-#%}{%%import \"io\"%%}\n"
+	want := "<%#egon:delims {% %}#%>\n<%=x%>{%= x %}{%-#c-#%}{%%import \"io\"%%}\n"
+	assert.Equal(t, want, format(t, src))
+}
+
+// Ensure that raw regions are kept as they are.
+func TestFormat_Raw(t *testing.T) {
+	src := "<%raw%><%=x%> <%  y  %><%endraw%><%=x%>"
+	want := "<%raw%><%=x%> <%  y  %><%endraw%><%= x %>"
+	assert.Equal(t, want, format(t, src))
+}
+
+// Ensure that translation blocks are spaced and their arguments formatted.
+func TestFormat_Translate(t *testing.T) {
+	src := "<%t   `Hello, {name}`  name=u.First+\" \"+u.Last  n=len( items )-%><%t \"{n} item\"  `{n} items` n=n%><%=n.2  x%>"
+	want := "<%t \"Hello, {name}\" name=u.First + \" \" + u.Last n=len(items) -%><%t \"{n} item\" \"{n} items\" n=n %><%=n.2 x %>"
+	assert.Equal(t, want, format(t, src))
+	assert.Equal(t, want, format(t, want))
+}
+
+// Ensure that directive blocks are spaced.
+func TestFormat_Directive(t *testing.T) {
+	src := "<%@filter   upper strings.ToUpper-%>\n<%=  u.Bio|truncate 80  %>"
+	want := "<%@ filter upper strings.ToUpper -%>\n<%=  u.Bio|truncate 80  %>"
+	assert.Equal(t, want, format(t, src))
+}
+
+// Ensure that component blocks are spaced and their arguments formatted.
+func TestFormat_Component(t *testing.T) {
+	src := "<%@component  ui.Card title=\"Hi, \"+name   class=css( \"card\" )-%>body<%@end%><%@ component Icon/%><%@children %>"
+	want := "<%@ component ui.Card title=\"Hi, \" + name class=css(\"card\") -%>body<%@ end %><%@ component Icon / %><%@ children %>"
+	assert.Equal(t, want, format(t, src))
+	assert.Equal(t, want, format(t, want))
+}
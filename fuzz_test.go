@@ -0,0 +1,144 @@
+package egon_test
+
+import (
+	"bytes"
+	"go/parser"
+	"go/token"
+	"io"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	. "github.com/titpetric/egon"
+)
+
+// seeds are added to the corpus of the fuzz targets, next to the inputs in
+// testdata/fuzz.
+var seeds = []string{
+	"hello world",
+	"<",
+	"<%",
+	"<p><%= name %></p>",
+	"<%! name string %><%== name %>",
+	"<%%\nimport \"strings\"\n%%>",
+	"<%# comment #%>",
+	"<%-# comment -#%>",
+	"<%- if x { -%>\n  <b>\n<%- } -%>",
+	"<%=d n %> <%=f.2 x %>",
+	"<% a := 10 % 3 %>",
+	"<%# 50% #done #%>",
+	"<%raw%><%= x %><%endraw%>",
+	"<%! ctx context.Context %><%t \"Hi, {name}\" name=u.Name %>",
+	"<%@ filter upper strings.ToUpper %><%= a | upper | b %>",
+	"<%@ component Card title=\"Hi\" %><p>body</p><%@ end %><%@ component Icon / %>",
+}
+
+// Ensure that scanning never panics, that the blocks read cover the input
+// exactly, and that text and comments are kept as they were written.
+func FuzzScan(f *testing.F) {
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, src string) {
+		s := NewScannerConfig(strings.NewReader(src), "fuzz.egon", &Config{StringOptimisations: true})
+		var raw strings.Builder
+		for {
+			b, err := s.Scan()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return
+			}
+
+			switch b := b.(type) {
+			case *TextBlock:
+				if b.Raw && !strings.Contains(b.Source, b.Content) || !b.Raw && b.Source != b.Content {
+					t.Fatalf("text %q was scanned as %q", b.Source, b.Content)
+				}
+				raw.WriteString(b.Source)
+			case *CommentBlock:
+				if !strings.Contains(b.Source, b.Content) {
+					t.Fatalf("comment %q was scanned as %q", b.Source, b.Content)
+				}
+				raw.WriteString(b.Source)
+			case *CodeBlock:
+				raw.WriteString(b.Source)
+			case *HeaderBlock:
+				raw.WriteString(b.Source)
+			case *ParameterBlock:
+				raw.WriteString(b.Source)
+			case *PrintBlock:
+				raw.WriteString(b.Source)
+			case *RawPrintBlock:
+				raw.WriteString(b.Source)
+			case *TranslateBlock:
+				raw.WriteString(b.Source)
+			case *DirectiveBlock:
+				raw.WriteString(b.Source)
+			case *ComponentBlock:
+				raw.WriteString(b.Source)
+			case *EndBlock:
+				raw.WriteString(b.Source)
+			}
+		}
+		if utf8.ValidString(src) && raw.String() != src {
+			t.Fatalf("blocks cover %q, not %q", raw.String(), src)
+		}
+	})
+}
+
+// Ensure that the code generated for a template always parses, as long as
+// the Go code in its blocks parses on its own.
+func FuzzParse(f *testing.F) {
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, src string) {
+		tmpl, err := ParseConfig(strings.NewReader(src), "views/fuzz.egon", &Config{StringOptimisations: true})
+		if err != nil || !validGo(tmpl) {
+			return
+		}
+
+		var buf bytes.Buffer
+		if err := tmpl.Write(&buf); err != nil {
+			return
+		}
+		if _, err := parser.ParseFile(token.NewFileSet(), "fuzz.egon.go", buf.Bytes(), 0); err != nil {
+			t.Fatalf("generated code doesn't parse: %s\n%s", err, buf.String())
+		}
+	})
+}
+
+// validGo returns whether the Go code of every block of tmpl parses on its
+// own.
+func validGo(tmpl *Template) bool {
+	parses := func(src string) bool {
+		_, err := parser.ParseFile(token.NewFileSet(), "", src, 0)
+		return err == nil
+	}
+	for _, b := range tmpl.Blocks {
+		switch b := b.(type) {
+		case *CodeBlock:
+			if !parses("package p\nfunc _() {\n" + b.Content + "\n}") {
+				return false
+			}
+		case *HeaderBlock:
+			if !parses("package p\n" + b.Content) {
+				return false
+			}
+		case *ParameterBlock:
+			if !token.IsIdentifier(b.ParamName) || !parses("package p\nfunc _(w io.Writer, "+b.ParamName+" "+b.ParamType+") {}") {
+				return false
+			}
+		case *PrintBlock:
+			if _, err := parser.ParseExpr(b.Content); err != nil {
+				return false
+			}
+		case *RawPrintBlock:
+			if _, err := parser.ParseExpr(b.Content); err != nil {
+				return false
+			}
+		}
+	}
+	return true
+}
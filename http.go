@@ -0,0 +1,56 @@
+package egon
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// DefaultContentType is used for views that don't set a content type.
+const DefaultContentType = "text/html; charset=utf-8"
+
+var bufferPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// ServeHTTP renders the view as the response, using the view's Status.
+func (view *View) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	Respond(w, r, view, view.Status)
+}
+
+// Respond renders view and writes it as the response with the given status
+// code, or 200 if status is 0. The view is rendered into a buffer first, so
+// a failing view results in a 500 Internal Server Error response instead of
+// a partially written page; the render error is returned.
+func Respond(w http.ResponseWriter, r *http.Request, view *View, status int) error {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer bufferPool.Put(buf)
+
+	if err := view.Render(buf); err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return err
+	}
+
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	header := w.Header()
+	if header.Get("Content-Type") == "" {
+		contentType := view.ContentType
+		if contentType == "" {
+			contentType = DefaultContentType
+		}
+		header.Set("Content-Type", contentType)
+	}
+	header.Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.WriteHeader(status)
+
+	if r != nil && r.Method == http.MethodHead {
+		return nil
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
@@ -0,0 +1,64 @@
+package egon_test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	. "github.com/titpetric/egon"
+)
+
+// Ensure that a view can be served as an http.Handler.
+func TestView_ServeHTTP(t *testing.T) {
+	view := &View{
+		Status: http.StatusNotFound,
+		RenderFunc: func(w io.Writer) error {
+			_, err := io.WriteString(w, "<p>not found</p>")
+			return err
+		},
+	}
+
+	rec := httptest.NewRecorder()
+	view.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, DefaultContentType, rec.Header().Get("Content-Type"))
+	assert.Equal(t, "<p>not found</p>", rec.Body.String())
+}
+
+// Ensure that a failing view responds with a 500 and no partial output.
+func TestRespond_Error(t *testing.T) {
+	view := &View{
+		ContentType: "text/plain; charset=utf-8",
+		RenderFunc: func(w io.Writer) error {
+			io.WriteString(w, "half a page")
+			return errors.New("boom")
+		},
+	}
+
+	rec := httptest.NewRecorder()
+	err := Respond(rec, httptest.NewRequest("GET", "/", nil), view, http.StatusOK)
+	assert.EqualError(t, err, "boom")
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "half a page")
+}
+
+// Ensure that HEAD requests get headers but no body.
+func TestRespond_Head(t *testing.T) {
+	view := &View{
+		ContentType: "application/json",
+		RenderFunc: func(w io.Writer) error {
+			_, err := io.WriteString(w, "{}")
+			return err
+		},
+	}
+
+	rec := httptest.NewRecorder()
+	assert.NoError(t, Respond(rec, httptest.NewRequest("HEAD", "/", nil), view, 0))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "2", rec.Header().Get("Content-Length"))
+	assert.Empty(t, rec.Body.String())
+}
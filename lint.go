@@ -0,0 +1,516 @@
+package egon
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/constant"
+	"go/scanner"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// LintRules describes the rules checked by Lint, keyed by name.
+var LintRules = map[string]string{
+	"raw":            "raw print block of a constant expression",
+	"raw-dynamic":    "raw print block of a non-constant expression",
+	"unused-param":   "template parameter that is never used",
+	"shadowed-param": "variable declaration that shadows a template parameter",
+	"unsafe-context": "print block in an HTML context where escaping is not enough",
+}
+
+// Problem is an issue found in a template by Lint.
+type Problem struct {
+	Pos     Pos
+	Rule    string
+	Message string
+}
+
+// Lint reads the blocks from s and returns the problems found in them,
+// ordered by line.
+//
+// A problem is suppressed by an "egon:allow" directive listing its rule, in
+// a comment or code block on the same line or the line before it:
+//
+//	<%# egon:allow raw #%>
+//	<%== sidebar %>
+//
+// Allowing a rule also allows the rules named after it, so "raw" covers
+// "raw-dynamic".
+func Lint(s *Scanner) ([]Problem, error) {
+	var (
+		problems []Problem
+		allows   []lintAllow
+		params   []*ParameterBlock
+		used     = map[string]bool{}
+		html     htmlContext
+	)
+	report := func(pos Pos, rule, format string, args ...interface{}) {
+		problems = append(problems, Problem{Pos: pos, Rule: rule, Message: fmt.Sprintf(format, args...)})
+	}
+
+	var blocks []Block
+	for {
+		pos := s.pos
+		b, err := s.Scan()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, scanError(pos, err)
+		}
+		blocks = append(blocks, b)
+
+		switch b := b.(type) {
+		case *TextBlock:
+			html.feed(b.Content)
+		case *CommentBlock:
+			allows = append(allows, parseAllow(b.Pos, b.Content)...)
+		case *CodeBlock:
+			allows = append(allows, parseAllow(b.Pos, b.Content)...)
+			identifiers(b.Content, used)
+		case *ParameterBlock:
+			params = append(params, b)
+		case *PrintBlock:
+			identifiers(b.Content, used)
+			if reason := html.unsafe(); reason != "" && !safePrintType(b.Type) {
+				report(b.Pos, "unsafe-context", "print block %s", reason)
+			}
+		case *TranslateBlock:
+			for _, arg := range b.Args {
+				identifiers(arg.Expr, used)
+			}
+		case *ComponentBlock:
+			for _, arg := range b.Args {
+				identifiers(arg.Expr, used)
+			}
+		case *DirectiveBlock:
+			if b.Name == "children" {
+				used["children"] = true
+			}
+		case *RawPrintBlock:
+			identifiers(b.Content, used)
+			if isConstant(b.Content) {
+				report(b.Pos, "raw", "raw print of constant %s", strings.TrimSpace(b.Content))
+			} else {
+				report(b.Pos, "raw-dynamic", "raw print of %s is not escaped", strings.TrimSpace(b.Content))
+			}
+		}
+	}
+
+	for _, param := range params {
+		if param.ParamName != "_" && !used[param.ParamName] {
+			report(param.Pos, "unused-param", "parameter %s is never used", param.ParamName)
+		}
+	}
+
+	names := map[string]bool{}
+	for _, param := range params {
+		names[param.ParamName] = param.ParamName != "_"
+	}
+	for _, b := range blocks {
+		if b, ok := b.(*CodeBlock); ok {
+			for _, name := range declarations(b.Content) {
+				if names[name] {
+					report(b.Pos, "shadowed-param", "declaration of %s shadows a template parameter", name)
+				}
+			}
+		}
+	}
+
+	out := problems[:0]
+	for _, p := range problems {
+		if !allowed(allows, p) {
+			out = append(out, p)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].Pos.LineNo < out[j].Pos.LineNo
+	})
+	return out, nil
+}
+
+// LintFile returns the problems found by Lint in the template at path,
+// scanned with config.
+func LintFile(path string, config *Config) ([]Problem, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Lint(NewScannerConfig(f, path, config))
+}
+
+// WriteProblems writes problems to w one per line, as "file:line: message
+// (rule)".
+func WriteProblems(w io.Writer, problems []Problem) error {
+	for _, p := range problems {
+		if _, err := fmt.Fprintf(w, "%s:%d: %s (%s)\n", p.Pos.Path, p.Pos.LineNo, p.Message, p.Rule); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// jsonProblem is a problem as written by WriteProblemsJSON.
+type jsonProblem struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// WriteProblemsJSON writes problems as a JSON array of objects with the
+// "file" and "line" of a problem, its "rule" and its "message".
+func WriteProblemsJSON(w io.Writer, problems []Problem) error {
+	out := make([]jsonProblem, len(problems))
+	for i, p := range problems {
+		out[i] = jsonProblem{File: p.Pos.Path, Line: p.Pos.LineNo, Rule: p.Rule, Message: p.Message}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+// WriteProblemsSARIF writes problems as a SARIF 2.1.0 log, which code
+// scanning services can annotate pull requests with.
+func WriteProblemsSARIF(w io.Writer, problems []Problem) error {
+	type message struct {
+		Text string `json:"text"`
+	}
+	type rule struct {
+		ID               string  `json:"id"`
+		ShortDescription message `json:"shortDescription"`
+	}
+	type location struct {
+		PhysicalLocation struct {
+			ArtifactLocation struct {
+				URI string `json:"uri"`
+			} `json:"artifactLocation"`
+			Region struct {
+				StartLine int `json:"startLine"`
+			} `json:"region"`
+		} `json:"physicalLocation"`
+	}
+	type result struct {
+		RuleID    string     `json:"ruleId"`
+		Level     string     `json:"level"`
+		Message   message    `json:"message"`
+		Locations []location `json:"locations"`
+	}
+
+	var rules []rule
+	for id, description := range LintRules {
+		rules = append(rules, rule{ID: id, ShortDescription: message{description}})
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].ID < rules[j].ID })
+
+	results := []result{}
+	for _, p := range problems {
+		var loc location
+		loc.PhysicalLocation.ArtifactLocation.URI = filepath.ToSlash(p.Pos.Path)
+		loc.PhysicalLocation.Region.StartLine = p.Pos.LineNo
+		results = append(results, result{
+			RuleID:    p.Rule,
+			Level:     "warning",
+			Message:   message{p.Message},
+			Locations: []location{loc},
+		})
+	}
+
+	log := map[string]interface{}{
+		"$schema": "https://json.schemastore.org/sarif-2.1.0.json",
+		"version": "2.1.0",
+		"runs": []interface{}{
+			map[string]interface{}{
+				"tool": map[string]interface{}{
+					"driver": map[string]interface{}{
+						"name":           "egon",
+						"informationUri": "https://github.com/titpetric/egon",
+						"rules":          rules,
+					},
+				},
+				"results": results,
+			},
+		},
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(log)
+}
+
+// lintAllow is an egon:allow directive, covering the lines from first to
+// last.
+type lintAllow struct {
+	first, last int
+	rules       []string
+}
+
+// parseAllow returns the egon:allow directives in the content of a comment
+// or code block at pos. A directive applies to its own lines and the line
+// after the block.
+func parseAllow(pos Pos, content string) []lintAllow {
+	var allows []lintAllow
+	for i, line := range strings.Split(content, "\n") {
+		j := strings.Index(line, "egon:allow")
+		if j < 0 {
+			continue
+		}
+		allows = append(allows, lintAllow{
+			first: pos.LineNo + i,
+			last:  pos.LineNo + strings.Count(content, "\n") + 1,
+			rules: strings.Fields(line[j+len("egon:allow"):]),
+		})
+	}
+	return allows
+}
+
+// allowed reports whether p is suppressed by one of allows.
+func allowed(allows []lintAllow, p Problem) bool {
+	for _, a := range allows {
+		if p.Pos.LineNo < a.first || p.Pos.LineNo > a.last {
+			continue
+		}
+		for _, rule := range a.rules {
+			if p.Rule == rule || strings.HasPrefix(p.Rule, rule+"-") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isConstant reports whether expr is a constant expression.
+func isConstant(expr string) bool {
+	tv, err := types.Eval(token.NewFileSet(), nil, token.NoPos, expr)
+	return err == nil && tv.Value != nil && tv.Value.Kind() != constant.Unknown
+}
+
+// safePrintType reports whether print blocks of the format code typ only
+// write numbers, which are safe in any context.
+func safePrintType(typ byte) bool {
+	switch typ {
+	case 'd', 'u', 'f', 'g', 't', 'D', 'n', 'L':
+		return true
+	}
+	return false
+}
+
+// goTokens returns the tokens of the Go source fragment src.
+func goTokens(src string) ([]token.Token, []string) {
+	var (
+		s    scanner.Scanner
+		toks []token.Token
+		lits []string
+	)
+	fset := token.NewFileSet()
+	s.Init(fset.AddFile("", -1, len(src)), []byte(src), nil, 0)
+	for {
+		_, tok, lit := s.Scan()
+		if tok == token.EOF {
+			return toks, lits
+		}
+		toks = append(toks, tok)
+		lits = append(lits, lit)
+	}
+}
+
+// identifiers records the identifiers referenced by the Go source fragment
+// src in used. Field and method names of selectors are skipped.
+func identifiers(src string, used map[string]bool) {
+	toks, lits := goTokens(src)
+	for i, tok := range toks {
+		if tok == token.IDENT && (i == 0 || toks[i-1] != token.PERIOD) {
+			used[lits[i]] = true
+		}
+	}
+}
+
+// declarations returns the names of the variables declared with := or var
+// by the Go source fragment src.
+func declarations(src string) []string {
+	var names []string
+	toks, lits := goTokens(src)
+	for i, tok := range toks {
+		switch tok {
+		case token.DEFINE:
+			for j := i - 1; j >= 0 && toks[j] == token.IDENT; j -= 2 {
+				names = append(names, lits[j])
+				if j == 0 || toks[j-1] != token.COMMA {
+					break
+				}
+			}
+		case token.VAR:
+			for j := i + 1; j < len(toks) && toks[j] == token.IDENT; j += 2 {
+				names = append(names, lits[j])
+				if j+1 >= len(toks) || toks[j+1] != token.COMMA {
+					break
+				}
+			}
+		}
+	}
+	return names
+}
+
+// htmlState is the position of an htmlContext within the HTML document.
+type htmlState int
+
+const (
+	htmlText        htmlState = iota // between tags
+	htmlTag                          // inside a tag, between attributes
+	htmlAttrName                     // inside an attribute name
+	htmlBeforeValue                  // after the "=" of an attribute
+	htmlQuoted                       // inside a quoted attribute value
+	htmlUnquoted                     // inside an unquoted attribute value
+	htmlComment                      // inside a comment
+	htmlRaw                          // inside an element whose contents aren't HTML
+)
+
+// urlAttributes are the attributes whose values are URLs.
+var urlAttributes = map[string]bool{
+	"href":       true,
+	"src":        true,
+	"action":     true,
+	"formaction": true,
+	"poster":     true,
+	"xlink:href": true,
+}
+
+// htmlContext tracks where in an HTML document the output of a template is,
+// as its static text is given piece by piece.
+type htmlContext struct {
+	state   htmlState
+	quote   byte   // quote of the current attribute value
+	attr    string // name of the current attribute
+	value   int    // length of the current attribute value so far
+	rawTag  string // name of the raw element opened by the current tag
+	rawEnd  string // closing tag of the current raw element, e.g. "</script"
+	rawName string // name of the current raw element
+}
+
+// feed advances the context past the text s.
+func (c *htmlContext) feed(s string) {
+	for i := 0; i < len(s); {
+		ch := s[i]
+		switch c.state {
+		case htmlRaw:
+			j := indexFold(s[i:], c.rawEnd)
+			if j < 0 {
+				return
+			}
+			i += j
+			c.state = htmlText
+			continue
+
+		case htmlComment:
+			j := strings.Index(s[i:], "-->")
+			if j < 0 {
+				return
+			}
+			i += j + len("-->")
+			c.state = htmlText
+			continue
+
+		case htmlText:
+			switch {
+			case strings.HasPrefix(s[i:], "<!--"):
+				i += len("<!--")
+				c.state = htmlComment
+				continue
+			case ch == '<' && i+1 < len(s) && isTagStart(s[i+1]):
+				name := strings.ToLower(tagName(s[i+1:]))
+				i += 1 + len(name)
+				c.rawTag = ""
+				if rawElements[name] {
+					c.rawTag = name
+				}
+				c.state = htmlTag
+				continue
+			}
+
+		case htmlTag, htmlAttrName:
+			switch {
+			case ch == '>':
+				c.closeTag()
+			case ch == '=':
+				c.state = htmlBeforeValue
+				c.value = 0
+			case isHTMLSpace(ch) || ch == '/':
+				c.state = htmlTag
+			case c.state == htmlTag:
+				c.state = htmlAttrName
+				c.attr = strings.ToLower(string(ch))
+			default:
+				c.attr += strings.ToLower(string(ch))
+			}
+
+		case htmlBeforeValue:
+			switch {
+			case ch == '>':
+				c.closeTag()
+			case ch == '"' || ch == '\'':
+				c.state = htmlQuoted
+				c.quote = ch
+			case !isHTMLSpace(ch):
+				c.state = htmlUnquoted
+				c.value = 1
+			}
+
+		case htmlQuoted:
+			if ch == c.quote {
+				c.state = htmlTag
+			} else {
+				c.value++
+			}
+
+		case htmlUnquoted:
+			switch {
+			case ch == '>':
+				c.closeTag()
+			case isHTMLSpace(ch):
+				c.state = htmlTag
+			default:
+				c.value++
+			}
+		}
+		i++
+	}
+}
+
+func (c *htmlContext) closeTag() {
+	c.state = htmlText
+	if c.rawTag != "" {
+		c.state = htmlRaw
+		c.rawName = c.rawTag
+		c.rawEnd = "</" + c.rawTag
+		c.rawTag = ""
+	}
+}
+
+// unsafe returns why escaped output is not safe at the current position, or
+// an empty string if it is.
+func (c *htmlContext) unsafe() string {
+	switch c.state {
+	case htmlRaw:
+		if c.rawName == "script" || c.rawName == "style" {
+			return fmt.Sprintf("inside a <%s> element", c.rawName)
+		}
+	case htmlTag, htmlAttrName:
+		return "inside a tag, outside of an attribute value"
+	case htmlBeforeValue, htmlUnquoted:
+		return fmt.Sprintf("in the unquoted value of attribute %s", c.attr)
+	case htmlQuoted:
+		switch {
+		case strings.HasPrefix(c.attr, "on"):
+			return fmt.Sprintf("inside event handler attribute %s", c.attr)
+		case c.attr == "style":
+			return "inside a style attribute"
+		case urlAttributes[c.attr] && c.value == 0:
+			return fmt.Sprintf("at the start of URL attribute %s", c.attr)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,139 @@
+package egon_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	. "github.com/titpetric/egon"
+)
+
+func lint(t *testing.T, src string) []string {
+	problems, err := Lint(NewScannerConfig(strings.NewReader(src), "tmp.egon", &Config{StringOptimisations: true}))
+	assert.NoError(t, err)
+
+	var out []string
+	for _, p := range problems {
+		out = append(out, fmt.Sprintf("%s %s:%d", p.Rule, p.Pos.Path, p.Pos.LineNo))
+	}
+	return out
+}
+
+// Ensure that raw prints are reported, and told apart by whether they print
+// a constant.
+func TestLint_RawPrint(t *testing.T) {
+	src := "<%! name string %>\n<%== \"<hr>\" %>\n<%== name %>\n"
+	assert.Equal(t, []string{"raw tmp.egon:2", "raw-dynamic tmp.egon:3"}, lint(t, src))
+}
+
+// Ensure that egon:allow suppresses problems on the same and the next line.
+func TestLint_Allow(t *testing.T) {
+	src := "<%! name string %>\n" +
+		"<%# egon:allow raw #%>\n" +
+		"<%== name %>\n" +
+		"<%== name %><% // egon:allow raw-dynamic %>\n" +
+		"<%== name %>\n" +
+		"\n" +
+		"<%== name %>\n"
+	assert.Equal(t, []string{"raw-dynamic tmp.egon:7"}, lint(t, src))
+}
+
+// Ensure that unused and shadowed parameters are reported.
+func TestLint_Parameters(t *testing.T) {
+	src := "<%! user *User %>\n" +
+		"<%! items []string %>\n" +
+		"<%! _ int %>\n" +
+		"<% for _, item := range items { %>\n" +
+		"<% a, items := 1, 2 %>\n" +
+		"<%= item.Name %><%= a %>\n" +
+		"<% } %>\n" +
+		"<%! name string %><%t \"Hi {name}\" name=name %>\n" +
+		"<%! title string %><%@ component Card title=title / %>\n" +
+		"<%! children func(io.Writer) error %><%@ children %>\n"
+	assert.Equal(t, []string{"unused-param tmp.egon:1", "shadowed-param tmp.egon:5"}, lint(t, src))
+}
+
+// Ensure that print blocks in contexts where HTML escaping isn't enough are
+// reported.
+func TestLint_UnsafeContext(t *testing.T) {
+	src := "<%! s string %>\n" +
+		"<p title=\"<%= s %>\"><%= s %></p>\n" +
+		"<a href=\"<%= s %>\">\n" +
+		"<a href=\"/users/<%= s %>\">\n" +
+		"<div onclick=\"go('<%= s %>')\" style=\"color: <%= s %>\">\n" +
+		"<input value=<%= s %>>\n" +
+		"<div <%= s %>>\n" +
+		"<script>var s = \"<%= s %>\", n = <%=d len(s) %>;</script>\n" +
+		"<p><%= s %></p>\n"
+	assert.Equal(t, []string{
+		"unsafe-context tmp.egon:3",
+		"unsafe-context tmp.egon:5",
+		"unsafe-context tmp.egon:5",
+		"unsafe-context tmp.egon:6",
+		"unsafe-context tmp.egon:7",
+		"unsafe-context tmp.egon:8",
+	}, lint(t, src))
+}
+
+// Ensure that the problems of template files are found, and written as
+// text, JSON and SARIF.
+func TestLintFile(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplates(t, dir, map[string]string{"page.egon": "<%! name string %>\n<%== name %>\n"})
+	path := filepath.Join(dir, "page.egon")
+	problems, err := LintFile(path, nil)
+	assert.NoError(t, err)
+	if !assert.Len(t, problems, 1) {
+		return
+	}
+	_, err = LintFile(filepath.Join(dir, "missing.egon"), nil)
+	assert.Error(t, err)
+
+	var buf bytes.Buffer
+	assert.NoError(t, WriteProblems(&buf, problems))
+	assert.Equal(t, path+":2: raw print of name is not escaped (raw-dynamic)\n", buf.String())
+
+	buf.Reset()
+	assert.NoError(t, WriteProblemsJSON(&buf, problems))
+	assert.JSONEq(t, `[{"file": `+strconv.Quote(path)+`, "line": 2, "rule": "raw-dynamic", "message": "raw print of name is not escaped"}]`, buf.String())
+
+	buf.Reset()
+	assert.NoError(t, WriteProblemsSARIF(&buf, problems))
+	var log struct {
+		Version string
+		Runs    []struct {
+			Tool struct {
+				Driver struct {
+					Rules []struct{ ID string }
+				}
+			}
+			Results []struct {
+				RuleID    string
+				Level     string
+				Message   struct{ Text string }
+				Locations []struct {
+					PhysicalLocation struct {
+						ArtifactLocation struct{ URI string }
+						Region           struct{ StartLine int }
+					}
+				}
+			}
+		}
+	}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &log))
+	assert.Equal(t, "2.1.0", log.Version)
+	if assert.Len(t, log.Runs, 1) && assert.Len(t, log.Runs[0].Results, 1) {
+		assert.Len(t, log.Runs[0].Tool.Driver.Rules, len(LintRules))
+		r := log.Runs[0].Results[0]
+		assert.Equal(t, "raw-dynamic", r.RuleID)
+		assert.Equal(t, "warning", r.Level)
+		assert.Equal(t, "raw print of name is not escaped", r.Message.Text)
+		assert.Equal(t, filepath.ToSlash(path), r.Locations[0].PhysicalLocation.ArtifactLocation.URI)
+		assert.Equal(t, 2, r.Locations[0].PhysicalLocation.Region.StartLine)
+	}
+}
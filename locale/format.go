@@ -0,0 +1,110 @@
+package locale
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Money is an amount in a currency, given by its ISO 4217 code, e.g.
+// "EUR".
+type Money struct {
+	Amount   float64
+	Currency string
+}
+
+// currencySymbols are the symbols of common currencies. Other currencies
+// are written with their code.
+var currencySymbols = map[string]string{
+	"EUR": "€", "USD": "$", "GBP": "£", "JPY": "¥", "CNY": "¥", "KRW": "₩",
+	"INR": "₹", "ILS": "₪", "TRY": "₺", "RUB": "₽", "UAH": "₴", "PLN": "zł",
+	"CZK": "Kč", "SEK": "kr", "DKK": "kr.", "NOK": "kr", "BRL": "R$",
+}
+
+// currencyDecimals are the minor unit digits of currencies that don't have
+// two.
+var currencyDecimals = map[string]int{
+	"JPY": 0, "KRW": 0, "ISK": 0, "CLP": 0, "VND": 0,
+	"BHD": 3, "KWD": 3, "OMR": 3, "TND": 3,
+}
+
+// AppendNumber appends x to dst with the decimal and grouping separators
+// of l, rounded to decimals digits after the decimal separator, or with as
+// many as needed if decimals is negative.
+func (l *Locale) AppendNumber(dst []byte, x float64, decimals int) []byte {
+	if math.IsNaN(x) || math.IsInf(x, 0) {
+		return strconv.AppendFloat(dst, x, 'f', -1, 64)
+	}
+	if x < 0 {
+		dst = append(dst, '-')
+		x = -x
+	}
+
+	var digits [32]byte
+	s := strconv.AppendFloat(digits[:0], x, 'f', decimals, 64)
+	point := len(s)
+	for i, c := range s {
+		if c == '.' {
+			point = i
+			break
+		}
+	}
+
+	integer := s[:point]
+	if len(integer) >= 3+l.minGrouping {
+		first := len(integer) % 3
+		if first == 0 {
+			first = 3
+		}
+		dst = append(dst, integer[:first]...)
+		for i := first; i < len(integer); i += 3 {
+			dst = append(dst, l.group...)
+			dst = append(dst, integer[i:i+3]...)
+		}
+	} else {
+		dst = append(dst, integer...)
+	}
+	if point < len(s) {
+		dst = append(dst, l.decimal...)
+		dst = append(dst, s[point+1:]...)
+	}
+	return dst
+}
+
+// FormatNumber returns x formatted like AppendNumber does.
+func (l *Locale) FormatNumber(x float64, decimals int) string {
+	return string(l.AppendNumber(nil, x, decimals))
+}
+
+// FormatMoney returns m formatted with the symbol of its currency, and the
+// digits after the decimal separator the currency has.
+func (l *Locale) FormatMoney(m Money) string {
+	code := strings.ToUpper(m.Currency)
+	symbol, ok := currencySymbols[code]
+	if !ok {
+		symbol = code
+	}
+	decimals, ok := currencyDecimals[code]
+	if !ok {
+		decimals = 2
+	}
+
+	var sign string
+	if m.Amount < 0 {
+		sign = "-"
+	}
+	number := l.FormatNumber(math.Abs(m.Amount), decimals)
+	return sign + strings.Replace(strings.Replace(l.money, "#", number, 1), "¤", symbol, 1)
+}
+
+// AppendDate appends the date of t to dst in the numeric form of l, or the
+// medium form for English, e.g. "Jan 2, 2006".
+func (l *Locale) AppendDate(dst []byte, t time.Time) []byte {
+	return t.AppendFormat(dst, l.date)
+}
+
+// FormatDate returns the date of t formatted like AppendDate does.
+func (l *Locale) FormatDate(t time.Time) string {
+	return t.Format(l.date)
+}
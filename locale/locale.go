@@ -0,0 +1,136 @@
+// Package locale formats numbers, amounts of money and dates, and picks
+// plural forms, by the conventions of a locale carried by the render
+// context of a template.
+//
+// Print blocks format with the locale of the context given by the format
+// codes 'n' (numbers, e.g. <%=n.2 price %>), 'M' (Money) and 'L' (dates),
+// and translation blocks with a plural message pick the plural form with
+// its plural rules:
+//
+//	ctx = locale.NewContext(ctx, locale.Match(r.Header.Get("Accept-Language")))
+//	views.CartTemplate(w, ctx, cart)
+package locale
+
+import (
+	"context"
+	"strconv"
+	"strings"
+)
+
+// Locale holds the conventions of a language, from the CLDR data for it.
+type Locale struct {
+	Tag string // BCP 47 language tag, e.g. "de"
+
+	plural      func(n int64) Form
+	decimal     string
+	group       string
+	minGrouping int    // digits the integer part needs beyond 3 to be grouped
+	money       string // pattern of amounts, "¤" standing for the symbol and "#" for the number
+	date        string // time.Format layout of dates
+}
+
+const (
+	nbsp       = "\u00a0"
+	narrowNbsp = "\u202f"
+)
+
+var locales = map[string]*Locale{
+	"ar": {plural: pluralArabic, decimal: ".", group: ",", minGrouping: 1, money: "#" + nbsp + "¤", date: "2/1/2006"},
+	"cs": {plural: pluralCzech, decimal: ",", group: nbsp, minGrouping: 1, money: "#" + nbsp + "¤", date: "2. 1. 2006"},
+	"da": {plural: pluralOne, decimal: ",", group: ".", minGrouping: 1, money: "#" + nbsp + "¤", date: "02.01.2006"},
+	"de": {plural: pluralOne, decimal: ",", group: ".", minGrouping: 1, money: "#" + nbsp + "¤", date: "02.01.2006"},
+	"en": {plural: pluralOne, decimal: ".", group: ",", minGrouping: 1, money: "¤#", date: "Jan 2, 2006"},
+	"es": {plural: pluralSpanish, decimal: ",", group: ".", minGrouping: 2, money: "#" + nbsp + "¤", date: "2/1/2006"},
+	"fi": {plural: pluralOne, decimal: ",", group: nbsp, minGrouping: 1, money: "#" + nbsp + "¤", date: "2.1.2006"},
+	"fr": {plural: pluralFrench, decimal: ",", group: narrowNbsp, minGrouping: 1, money: "#" + nbsp + "¤", date: "02/01/2006"},
+	"he": {plural: pluralHebrew, decimal: ".", group: ",", minGrouping: 1, money: "#" + nbsp + "¤", date: "2.1.2006"},
+	"it": {plural: pluralSpanish, decimal: ",", group: ".", minGrouping: 1, money: "#" + nbsp + "¤", date: "02/01/2006"},
+	"ja": {plural: pluralOther, decimal: ".", group: ",", minGrouping: 1, money: "¤#", date: "2006/01/02"},
+	"ko": {plural: pluralOther, decimal: ".", group: ",", minGrouping: 1, money: "¤#", date: "2006. 1. 2."},
+	"nb": {plural: pluralOne, decimal: ",", group: nbsp, minGrouping: 1, money: "#" + nbsp + "¤", date: "02.01.2006"},
+	"nl": {plural: pluralOne, decimal: ",", group: ".", minGrouping: 1, money: "¤" + nbsp + "#", date: "02-01-2006"},
+	"pl": {plural: pluralPolish, decimal: ",", group: nbsp, minGrouping: 2, money: "#" + nbsp + "¤", date: "02.01.2006"},
+	"pt": {plural: pluralFrench, decimal: ",", group: ".", minGrouping: 1, money: "¤" + nbsp + "#", date: "02/01/2006"},
+	"ru": {plural: pluralRussian, decimal: ",", group: nbsp, minGrouping: 1, money: "#" + nbsp + "¤", date: "02.01.2006"},
+	"sv": {plural: pluralOne, decimal: ",", group: nbsp, minGrouping: 1, money: "#" + nbsp + "¤", date: "2006-01-02"},
+	"tr": {plural: pluralOne, decimal: ",", group: ".", minGrouping: 1, money: "¤#", date: "02.01.2006"},
+	"uk": {plural: pluralRussian, decimal: ",", group: nbsp, minGrouping: 1, money: "#" + nbsp + "¤", date: "02.01.2006"},
+	"zh": {plural: pluralOther, decimal: ".", group: ",", minGrouping: 1, money: "¤#", date: "2006/1/2"},
+}
+
+func init() {
+	for tag, l := range locales {
+		l.Tag = tag
+	}
+}
+
+// Default is the locale used when a context carries none, English.
+var Default = locales["en"]
+
+// Lookup returns the locale of the language tag, e.g. "pt-BR" or "de_AT",
+// falling back to its base language, and to Default for languages without
+// data.
+func Lookup(tag string) *Locale {
+	if l, ok := lookup(tag); ok {
+		return l
+	}
+	return Default
+}
+
+func lookup(tag string) (*Locale, bool) {
+	tag = strings.ToLower(strings.TrimSpace(strings.Replace(tag, "_", "-", -1)))
+	if l, ok := locales[tag]; ok {
+		return l, true
+	}
+	if i := strings.IndexByte(tag, '-'); i >= 0 {
+		l, ok := locales[tag[:i]]
+		return l, ok
+	}
+	return nil, false
+}
+
+// Match returns the locale best matching an Accept-Language header: the one
+// of the language with the highest quality that has data, or Default.
+func Match(acceptLanguage string) *Locale {
+	var (
+		best    *Locale
+		quality = -1.0
+	)
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		fields := strings.Split(part, ";")
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if l, ok := lookup(fields[0]); ok && q > quality && q > 0 {
+			best, quality = l, q
+		}
+	}
+	if best == nil {
+		return Default
+	}
+	return best
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying l.
+func NewContext(ctx context.Context, l *Locale) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// FromContext returns the locale carried by ctx, or Default if there is
+// none.
+func FromContext(ctx context.Context) *Locale {
+	if ctx != nil {
+		if l, ok := ctx.Value(contextKey{}).(*Locale); ok && l != nil {
+			return l
+		}
+	}
+	return Default
+}
@@ -0,0 +1,75 @@
+package locale_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/titpetric/egon/locale"
+)
+
+// Ensure that counts get the CLDR plural category of their language.
+func TestLocale_Plural(t *testing.T) {
+	tests := map[string]map[int64]locale.Form{
+		"en": {0: locale.Other, 1: locale.One, 2: locale.Other, -1: locale.One},
+		"fr": {0: locale.One, 1: locale.One, 2: locale.Other, 1000000: locale.Many},
+		"ru": {1: locale.One, 21: locale.One, 11: locale.Many, 3: locale.Few, 13: locale.Many, 5: locale.Many, 102: locale.Few},
+		"pl": {1: locale.One, 21: locale.Many, 22: locale.Few, 12: locale.Many},
+		"cs": {1: locale.One, 4: locale.Few, 5: locale.Other},
+		"ar": {0: locale.Zero, 1: locale.One, 2: locale.Two, 3: locale.Few, 11: locale.Many, 100: locale.Other, 103: locale.Few},
+		"ja": {1: locale.Other},
+	}
+	for tag, counts := range tests {
+		for n, want := range counts {
+			assert.Equal(t, want, locale.Lookup(tag).Plural(n), "%s %d", tag, n)
+		}
+	}
+	assert.Equal(t, "few", locale.Few.String())
+}
+
+// Ensure that numbers get the separators of their locale.
+func TestLocale_FormatNumber(t *testing.T) {
+	assert.Equal(t, "1,234,567.5", locale.Lookup("en").FormatNumber(1234567.5, -1))
+	assert.Equal(t, "-1.234,50", locale.Lookup("de").FormatNumber(-1234.5, 2))
+	assert.Equal(t, "1 234,50", locale.Lookup("fr").FormatNumber(1234.5, 2))
+	assert.Equal(t, "1234", locale.Lookup("es").FormatNumber(1234, 0))
+	assert.Equal(t, "12.345", locale.Lookup("es").FormatNumber(12345, 0))
+	assert.Equal(t, "999", locale.Lookup("en").FormatNumber(999, -1))
+	assert.Equal(t, "NaN", locale.Lookup("en").FormatNumber(0/zero(), -1))
+}
+
+func zero() float64 { return 0 }
+
+// Ensure that amounts of money are written with the currency symbol and
+// digits of their currency.
+func TestLocale_FormatMoney(t *testing.T) {
+	assert.Equal(t, "$1,234.50", locale.Lookup("en").FormatMoney(locale.Money{Amount: 1234.5, Currency: "USD"}))
+	assert.Equal(t, "1.234,50 €", locale.Lookup("de").FormatMoney(locale.Money{Amount: 1234.5, Currency: "EUR"}))
+	assert.Equal(t, "-¥1,235", locale.Lookup("ja").FormatMoney(locale.Money{Amount: -1234.6, Currency: "jpy"}))
+	assert.Equal(t, "CHF 10,00", locale.Lookup("nl").FormatMoney(locale.Money{Amount: 10, Currency: "CHF"}))
+}
+
+// Ensure that dates are written in the form of their locale.
+func TestLocale_FormatDate(t *testing.T) {
+	date := time.Date(2024, 3, 7, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, "Mar 7, 2024", locale.Lookup("en").FormatDate(date))
+	assert.Equal(t, "07.03.2024", locale.Lookup("de").FormatDate(date))
+	assert.Equal(t, "2024/03/07", locale.Lookup("ja").FormatDate(date))
+}
+
+// Ensure that locales are found by tag and Accept-Language header, and
+// carried by contexts.
+func TestLookup(t *testing.T) {
+	assert.Equal(t, "pt", locale.Lookup("pt-BR").Tag)
+	assert.Equal(t, "de", locale.Lookup("de_AT").Tag)
+	assert.Equal(t, "en", locale.Lookup("xx").Tag)
+
+	assert.Equal(t, "fr", locale.Match("xx, fr-CH;q=0.9, de;q=0.8").Tag)
+	assert.Equal(t, "de", locale.Match("fr;q=0.5, de").Tag)
+	assert.Equal(t, "en", locale.Match("").Tag)
+
+	assert.Equal(t, locale.Default, locale.FromContext(context.Background()))
+	ctx := locale.NewContext(context.Background(), locale.Lookup("ru"))
+	assert.Equal(t, "ru", locale.FromContext(ctx).Tag)
+}
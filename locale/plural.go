@@ -0,0 +1,126 @@
+package locale
+
+// Form is a CLDR plural category.
+type Form int
+
+// The plural categories. Languages use Other and a subset of the rest.
+const (
+	Other Form = iota
+	Zero
+	One
+	Two
+	Few
+	Many
+)
+
+var formNames = [...]string{"other", "zero", "one", "two", "few", "many"}
+
+// String returns the CLDR name of f, e.g. "one".
+func (f Form) String() string {
+	if f < 0 || int(f) >= len(formNames) {
+		return "other"
+	}
+	return formNames[f]
+}
+
+// Plural returns the plural category of the count n in the language of l.
+// The rules are the CLDR cardinal rules for integers.
+func (l *Locale) Plural(n int64) Form {
+	if n < 0 {
+		n = -n
+	}
+	return l.plural(n)
+}
+
+// pluralOther is the rule of languages without plural forms, like Japanese.
+func pluralOther(n int64) Form {
+	return Other
+}
+
+// pluralOne is the rule of English, German and most Germanic languages.
+func pluralOne(n int64) Form {
+	if n == 1 {
+		return One
+	}
+	return Other
+}
+
+// pluralFrench is the rule of French and Portuguese, where 0 is singular.
+func pluralFrench(n int64) Form {
+	switch {
+	case n == 0 || n == 1:
+		return One
+	case n%1000000 == 0:
+		return Many
+	}
+	return Other
+}
+
+// pluralSpanish is the rule of Spanish and Italian.
+func pluralSpanish(n int64) Form {
+	switch {
+	case n == 1:
+		return One
+	case n != 0 && n%1000000 == 0:
+		return Many
+	}
+	return Other
+}
+
+// pluralRussian is the rule of Russian and Ukrainian.
+func pluralRussian(n int64) Form {
+	switch {
+	case n%10 == 1 && n%100 != 11:
+		return One
+	case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+		return Few
+	}
+	return Many
+}
+
+func pluralPolish(n int64) Form {
+	switch {
+	case n == 1:
+		return One
+	case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+		return Few
+	}
+	return Many
+}
+
+// pluralCzech is the rule of Czech and Slovak.
+func pluralCzech(n int64) Form {
+	switch {
+	case n == 1:
+		return One
+	case n >= 2 && n <= 4:
+		return Few
+	}
+	return Other
+}
+
+func pluralArabic(n int64) Form {
+	switch {
+	case n == 0:
+		return Zero
+	case n == 1:
+		return One
+	case n == 2:
+		return Two
+	case n%100 >= 3 && n%100 <= 10:
+		return Few
+	case n%100 >= 11:
+		return Many
+	}
+	return Other
+}
+
+func pluralHebrew(n int64) Form {
+	switch n {
+	case 1:
+		return One
+	case 2:
+		return Two
+	}
+	return Other
+}
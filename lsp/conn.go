@@ -0,0 +1,235 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"sync"
+)
+
+// Request is a request or a notification received on a Conn.
+// Notifications have no ID.
+type Request struct {
+	ID     *json.RawMessage
+	Method string
+	Params json.RawMessage
+}
+
+// Error is a JSON-RPC error response.
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("jsonrpc: code %d: %s", e.Code, e.Message)
+}
+
+// JSON-RPC error codes.
+const (
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+)
+
+// Handler handles the requests and notifications received on a Conn.
+// Returning an error stops the Conn.
+type Handler func(c *Conn, req *Request) error
+
+// Conn is a JSON-RPC 2.0 connection using the base protocol of LSP, where
+// every message is preceded by a Content-Length header.
+type Conn struct {
+	r       *bufio.Reader
+	w       io.Writer
+	handler Handler
+
+	wmu sync.Mutex // guards writes to w
+
+	mu      sync.Mutex
+	seq     int64
+	pending map[string]chan *message
+	err     error
+}
+
+// message is a request, notification or response.
+type message struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+	Result  json.RawMessage  `json:"result,omitempty"`
+	Error   *Error           `json:"error,omitempty"`
+}
+
+// NewConn returns a Conn reading messages from r and writing them to w.
+// Requests and notifications are passed to handler, which may be nil if
+// none are expected.
+func NewConn(r io.Reader, w io.Writer, handler Handler) *Conn {
+	return &Conn{
+		r:       bufio.NewReader(r),
+		w:       w,
+		handler: handler,
+		pending: make(map[string]chan *message),
+	}
+}
+
+// Run reads messages until the connection is closed or the handler returns
+// an error. Requests are handled one at a time, in the order they arrive.
+func (c *Conn) Run() error {
+	err := c.run()
+
+	c.mu.Lock()
+	c.err = err
+	if c.err == nil {
+		c.err = io.EOF
+	}
+	for id, ch := range c.pending {
+		close(ch)
+		delete(c.pending, id)
+	}
+	c.mu.Unlock()
+	return err
+}
+
+func (c *Conn) run() error {
+	for {
+		msg, err := c.read()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if msg.Method == "" {
+			c.mu.Lock()
+			ch := c.pending[string(*msg.ID)]
+			delete(c.pending, string(*msg.ID))
+			c.mu.Unlock()
+			if ch != nil {
+				ch <- msg
+			}
+			continue
+		}
+
+		req := &Request{ID: msg.ID, Method: msg.Method, Params: msg.Params}
+		if c.handler == nil {
+			if req.ID != nil {
+				c.Reply(req, nil, &Error{Code: CodeMethodNotFound, Message: "method not found: " + req.Method})
+			}
+			continue
+		}
+		if err := c.handler(c, req); err != nil {
+			return err
+		}
+	}
+}
+
+// Call sends a request and waits for its response, which is decoded into
+// result unless it is nil. Run must be running for the response to be read.
+func (c *Conn) Call(method string, params, result interface{}) error {
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return c.err
+	}
+	c.seq++
+	id := json.RawMessage(strconv.FormatInt(c.seq, 10))
+	ch := make(chan *message, 1)
+	c.pending[string(id)] = ch
+	c.mu.Unlock()
+
+	if err := c.send(&message{ID: &id, Method: method}, params); err != nil {
+		return err
+	}
+
+	resp, ok := <-ch
+	if !ok {
+		return io.ErrUnexpectedEOF
+	}
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if result == nil || len(resp.Result) == 0 {
+		return nil
+	}
+	return json.Unmarshal(resp.Result, result)
+}
+
+// Notify sends a notification.
+func (c *Conn) Notify(method string, params interface{}) error {
+	return c.send(&message{Method: method}, params)
+}
+
+// Reply sends the response to req, which is err if it isn't nil. Nothing is
+// sent for notifications.
+func (c *Conn) Reply(req *Request, result interface{}, err error) error {
+	if req.ID == nil {
+		return nil
+	}
+	msg := &message{ID: req.ID}
+	if err != nil {
+		rpcErr, ok := err.(*Error)
+		if !ok {
+			rpcErr = &Error{Code: CodeInternalError, Message: err.Error()}
+		}
+		msg.Error = rpcErr
+		return c.send(msg, nil)
+	}
+
+	b, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	msg.Result = b
+	return c.send(msg, nil)
+}
+
+func (c *Conn) send(msg *message, params interface{}) error {
+	msg.JSONRPC = "2.0"
+	if params != nil {
+		b, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		msg.Params = b
+	}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if _, err := fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n", len(body)); err != nil {
+		return err
+	}
+	_, err = c.w.Write(body)
+	return err
+}
+
+func (c *Conn) read() (*message, error) {
+	header, err := textproto.NewReader(c.r).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		return nil, fmt.Errorf("jsonrpc: invalid Content-Length: %q", header.Get("Content-Length"))
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(c.r, body); err != nil {
+		return nil, err
+	}
+	msg := &message{}
+	if err := json.Unmarshal(body, msg); err != nil {
+		return nil, err
+	}
+	if msg.Method == "" && msg.ID == nil {
+		return nil, fmt.Errorf("jsonrpc: message without a method or an id")
+	}
+	return msg, nil
+}
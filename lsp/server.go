@@ -0,0 +1,570 @@
+// Package lsp implements a language server for egon templates.
+//
+// The server reports scanner errors as the template is edited, and the Go
+// syntax and type errors of the generated code, mapped back to the
+// template, whenever it is opened or saved, or the client reports changes to
+// watched files. Hover and go to definition
+// requests on the Go code in the template are forwarded to gopls, which is
+// given the generated code for the template, and completion offers the
+// parameters declared by the template.
+package lsp
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"go/scanner"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"unicode"
+
+	"github.com/titpetric/egon"
+)
+
+// errExit stops the server when the client sends the exit notification.
+var errExit = errors.New("lsp: exit")
+
+// Server is a language server for egon templates. A Server serves a single
+// client.
+type Server struct {
+	// Config is used when parsing and generating templates.
+	Config *egon.Config
+
+	// Gopls starts the gopls process that hover and definition requests
+	// are forwarded to. By default, gopls is run from PATH.
+	Gopls func() (io.ReadWriteCloser, error)
+
+	client *Conn
+	root   string
+	docs   map[string]*document
+
+	// importer imports the packages of templates when they are checked.
+	// It caches the packages it imports, so it is dropped whenever a file
+	// is saved or changes.
+	importer types.ImporterFrom
+
+	gopls      *Conn
+	goplsErr   error
+	goplsClose io.Closer
+	goplsDocs  map[string]*goplsDoc
+}
+
+// document is a template opened by the client.
+type document struct {
+	uri  string
+	path string
+	text string
+
+	// gen is the generated code, or nil if the template changed since it
+	// was last generated.
+	gen *generated
+}
+
+// generated is the Go code generated for a document.
+type generated struct {
+	uri      string
+	text     string
+	segments []egon.Segment
+}
+
+// goplsDoc is a generated file opened in gopls.
+type goplsDoc struct {
+	version int
+	text    string
+}
+
+// NewServer returns a Server that parses and generates templates with
+// config.
+func NewServer(config *egon.Config) *Server {
+	return &Server{
+		Config:    config,
+		docs:      make(map[string]*document),
+		goplsDocs: make(map[string]*goplsDoc),
+	}
+}
+
+// Serve serves the client connected through r and w, until the client
+// sends the exit notification or closes the connection.
+func (s *Server) Serve(r io.Reader, w io.Writer) error {
+	s.client = NewConn(r, w, s.handle)
+	err := s.client.Run()
+	s.stopGopls()
+	if err == errExit {
+		return nil
+	}
+	return err
+}
+
+func (s *Server) handle(c *Conn, req *Request) error {
+	switch req.Method {
+	case "initialize":
+		var params initializeParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return c.Reply(req, nil, &Error{Code: CodeInvalidParams, Message: err.Error()})
+		}
+		s.root = params.RootURI
+		return c.Reply(req, map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":   1, // full
+				"hoverProvider":      true,
+				"definitionProvider": true,
+				"completionProvider": map[string]interface{}{},
+			},
+			"serverInfo": map[string]string{"name": "egon"},
+		}, nil)
+
+	case "initialized":
+		return nil
+
+	case "shutdown":
+		s.stopGopls()
+		return c.Reply(req, nil, nil)
+
+	case "exit":
+		return errExit
+
+	case "textDocument/didOpen":
+		var params didOpenParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil
+		}
+		doc := &document{
+			uri:  params.TextDocument.URI,
+			path: uriToPath(params.TextDocument.URI),
+			text: params.TextDocument.Text,
+		}
+		s.docs[doc.uri] = doc
+		return s.publish(doc, true)
+
+	case "textDocument/didChange":
+		var params didChangeParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil
+		}
+		doc, ok := s.docs[params.TextDocument.URI]
+		if !ok || len(params.ContentChanges) == 0 {
+			return nil
+		}
+		doc.text = params.ContentChanges[len(params.ContentChanges)-1].Text
+		doc.gen = nil
+		return s.publish(doc, false)
+
+	case "textDocument/didSave":
+		var params didCloseParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil
+		}
+		s.reset()
+		if doc, ok := s.docs[params.TextDocument.URI]; ok {
+			return s.publish(doc, true)
+		}
+		return nil
+
+	case "workspace/didChangeWatchedFiles":
+		s.reset()
+		for _, doc := range s.docs {
+			if err := s.publish(doc, true); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case "textDocument/didClose":
+		var params didCloseParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil
+		}
+		delete(s.docs, params.TextDocument.URI)
+		return c.Notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+			URI:         params.TextDocument.URI,
+			Diagnostics: []Diagnostic{},
+		})
+
+	case "textDocument/hover":
+		var params textDocumentPositionParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return c.Reply(req, nil, &Error{Code: CodeInvalidParams, Message: err.Error()})
+		}
+		hover, err := s.hover(params)
+		return c.Reply(req, hover, err)
+
+	case "textDocument/definition":
+		var params textDocumentPositionParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return c.Reply(req, nil, &Error{Code: CodeInvalidParams, Message: err.Error()})
+		}
+		locations, err := s.definition(params)
+		return c.Reply(req, locations, err)
+
+	case "textDocument/completion":
+		var params textDocumentPositionParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return c.Reply(req, nil, &Error{Code: CodeInvalidParams, Message: err.Error()})
+		}
+		return c.Reply(req, s.completion(params), nil)
+	}
+
+	return c.Reply(req, nil, &Error{Code: CodeMethodNotFound, Message: "method not found: " + req.Method})
+}
+
+// publish sends the diagnostics of doc to the client. Unless check is set,
+// only scanner errors are reported, as type checking the template takes
+// too long to do on every change.
+func (s *Server) publish(doc *document, check bool) error {
+	diagnostics := []Diagnostic{}
+	add := func(pos token.Position, msg string) {
+		start := Position{Line: pos.Line - 1}
+		if pos.Offset > 0 {
+			start = positionOf(doc.text, pos.Offset)
+		}
+		if start.Line < 0 {
+			start.Line = 0
+		}
+		diagnostics = append(diagnostics, Diagnostic{
+			Range:    Range{Start: start, End: start},
+			Severity: SeverityError,
+			Source:   "egon",
+			Message:  msg,
+		})
+	}
+
+	t, err := egon.ParseConfig(strings.NewReader(doc.text), doc.path, s.config())
+	if err == nil && check {
+		err = t.Check()
+	}
+	switch err := err.(type) {
+	case nil:
+	case scanner.ErrorList:
+		for _, e := range err {
+			add(e.Pos, e.Msg)
+		}
+	case *scanner.Error:
+		add(err.Pos, err.Msg)
+	default:
+		add(token.Position{}, err.Error())
+	}
+
+	return s.client.Notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+		URI:         doc.uri,
+		Diagnostics: diagnostics,
+	})
+}
+
+// config returns the configuration templates are parsed with, which
+// imports packages with the importer of the server.
+func (s *Server) config() *egon.Config {
+	var config egon.Config
+	if s.Config != nil {
+		config = *s.Config
+	}
+	if s.importer == nil {
+		s.importer = egon.NewImporter()
+	}
+	config.Importer = s.importer
+	return &config
+}
+
+// reset drops the imported packages and the generated code of the
+// documents, as they may depend on files that changed.
+func (s *Server) reset() {
+	s.importer = nil
+	for _, doc := range s.docs {
+		doc.gen = nil
+	}
+}
+
+// generate returns the generated code of doc.
+func (s *Server) generate(doc *document) (*generated, error) {
+	if doc.gen != nil {
+		return doc.gen, nil
+	}
+	t, err := egon.ParseConfig(strings.NewReader(doc.text), doc.path, s.config())
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	segments, err := t.WriteMapped(&buf)
+	if err != nil {
+		return nil, err
+	}
+	doc.gen = &generated{uri: pathToURI(t.SourceFile()), text: buf.String(), segments: segments}
+	return doc.gen, nil
+}
+
+// forward maps the position of a request to the generated code of the
+// template and sends the request to gopls. It returns nil if the position
+// isn't in the Go code of the template.
+func (s *Server) forward(method string, params textDocumentPositionParams) (*document, *generated, json.RawMessage, error) {
+	doc, ok := s.docs[params.TextDocument.URI]
+	if !ok {
+		return nil, nil, nil, nil
+	}
+	gen, err := s.generate(doc)
+	if err != nil {
+		return nil, nil, nil, nil
+	}
+	offset, ok := egon.GeneratedOffset(gen.segments, offsetOf(doc.text, params.Position))
+	if !ok {
+		return nil, nil, nil, nil
+	}
+
+	gopls, err := s.syncGopls(gen)
+	if err != nil {
+		return nil, nil, nil, nil
+	}
+	var result json.RawMessage
+	err = gopls.Call(method, textDocumentPositionParams{
+		TextDocument: textDocumentIdentifier{URI: gen.uri},
+		Position:     positionOf(gen.text, offset),
+	}, &result)
+	if err != nil || len(result) == 0 || string(result) == "null" {
+		return nil, nil, nil, err
+	}
+	return doc, gen, result, nil
+}
+
+func (s *Server) hover(params textDocumentPositionParams) (*Hover, error) {
+	doc, gen, result, err := s.forward("textDocument/hover", params)
+	if result == nil {
+		return nil, err
+	}
+	var hover Hover
+	if err := json.Unmarshal(result, &hover); err != nil {
+		return nil, err
+	}
+	if hover.Range != nil {
+		hover.Range = mapRange(doc, gen, *hover.Range)
+	}
+	return &hover, nil
+}
+
+func (s *Server) definition(params textDocumentPositionParams) ([]Location, error) {
+	doc, gen, result, err := s.forward("textDocument/definition", params)
+	if result == nil {
+		return nil, err
+	}
+	var links []locationLink
+	if bytes.HasPrefix(bytes.TrimSpace(result), []byte("[")) {
+		err = json.Unmarshal(result, &links)
+	} else {
+		links = make([]locationLink, 1)
+		err = json.Unmarshal(result, &links[0])
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	locations := []Location{}
+	for _, link := range links {
+		uri, rng := link.URI, link.Range
+		if link.TargetURI != "" {
+			uri, rng = link.TargetURI, link.TargetSelectionRange
+		}
+		if rng == nil {
+			continue
+		}
+		if uri == gen.uri {
+			// Definitions in the template itself.
+			if rng = mapRange(doc, gen, *rng); rng == nil {
+				continue
+			}
+			uri = doc.uri
+		}
+		locations = append(locations, Location{URI: uri, Range: *rng})
+	}
+	return locations, nil
+}
+
+// mapRange maps a range of the generated code of doc back to the template,
+// or returns nil if it isn't within the Go code of a block.
+func mapRange(doc *document, gen *generated, r Range) *Range {
+	start, ok := egon.SourceOffset(gen.segments, offsetOf(gen.text, r.Start))
+	if !ok {
+		return nil
+	}
+	end, ok := egon.SourceOffset(gen.segments, offsetOf(gen.text, r.End))
+	if !ok {
+		return nil
+	}
+	return &Range{Start: positionOf(doc.text, start), End: positionOf(doc.text, end)}
+}
+
+// completion returns the parameters of the template matching the
+// identifier before the position, if it is within a code or print block.
+func (s *Server) completion(params textDocumentPositionParams) *CompletionList {
+	list := &CompletionList{Items: []CompletionItem{}}
+	doc, ok := s.docs[params.TextDocument.URI]
+	if !ok {
+		return list
+	}
+
+	// The template may not parse while a block is being typed, so the
+	// parameters are read up to the first error, and the block around the
+	// position is found in the text.
+	var paramBlocks []*egon.ParameterBlock
+	sc := egon.NewScannerConfig(strings.NewReader(doc.text), doc.path, s.Config)
+	for {
+		b, err := sc.Scan()
+		if err != nil {
+			break
+		}
+		if p, ok := b.(*egon.ParameterBlock); ok {
+			paramBlocks = append(paramBlocks, p)
+		}
+	}
+
+	delims := sc.Delims()
+	before := doc.text[:offsetOf(doc.text, params.Position)]
+	open := strings.LastIndex(before, delims.Open)
+	if open < 0 || strings.LastIndex(before, delims.Close) > open {
+		return list
+	}
+	kind := strings.TrimPrefix(before[open+len(delims.Open):], "-")
+	if strings.HasPrefix(kind, "!") || strings.HasPrefix(kind, "#") || strings.HasPrefix(kind, "%") {
+		return list
+	}
+
+	prefix := before[len(strings.TrimRightFunc(before, isIdent)):]
+	if strings.HasSuffix(before[:len(before)-len(prefix)], ".") {
+		return list
+	}
+	for _, p := range paramBlocks {
+		if strings.HasPrefix(p.ParamName, prefix) {
+			list.Items = append(list.Items, CompletionItem{
+				Label:  p.ParamName,
+				Kind:   CompletionItemKindVariable,
+				Detail: p.ParamType,
+			})
+		}
+	}
+	return list
+}
+
+func isIdent(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// syncGopls starts gopls if needed, and opens the generated code in it or
+// updates it.
+func (s *Server) syncGopls(gen *generated) (*Conn, error) {
+	gopls, err := s.startGopls()
+	if err != nil {
+		return nil, err
+	}
+
+	doc, ok := s.goplsDocs[gen.uri]
+	switch {
+	case !ok:
+		doc = &goplsDoc{version: 1, text: gen.text}
+		s.goplsDocs[gen.uri] = doc
+		err = gopls.Notify("textDocument/didOpen", didOpenParams{
+			TextDocument: textDocumentItem{URI: gen.uri, LanguageID: "go", Version: doc.version, Text: doc.text},
+		})
+	case doc.text != gen.text:
+		doc.version++
+		doc.text = gen.text
+		err = gopls.Notify("textDocument/didChange", map[string]interface{}{
+			"textDocument":   versionedTextDocumentIdentifier{URI: gen.uri, Version: doc.version},
+			"contentChanges": []map[string]string{{"text": doc.text}},
+		})
+	}
+	return gopls, err
+}
+
+// startGopls starts gopls and initializes it, once.
+func (s *Server) startGopls() (*Conn, error) {
+	if s.gopls != nil || s.goplsErr != nil {
+		return s.gopls, s.goplsErr
+	}
+
+	start := s.Gopls
+	if start == nil {
+		start = execGopls
+	}
+	rwc, err := start()
+	if err != nil {
+		s.goplsErr = err
+		s.client.Notify("window/logMessage", map[string]interface{}{
+			"type":    1,
+			"message": "egon: starting gopls: " + err.Error(),
+		})
+		return nil, err
+	}
+
+	gopls := NewConn(rwc, rwc, replyGopls)
+	go gopls.Run()
+	err = gopls.Call("initialize", map[string]interface{}{
+		"processId":    os.Getpid(),
+		"rootUri":      s.root,
+		"capabilities": map[string]interface{}{},
+	}, nil)
+	if err == nil {
+		err = gopls.Notify("initialized", map[string]interface{}{})
+	}
+	if err != nil {
+		rwc.Close()
+		s.goplsErr = err
+		return nil, err
+	}
+
+	s.gopls = gopls
+	s.goplsClose = rwc
+	return gopls, nil
+}
+
+// replyGopls answers the requests gopls sends to its client.
+func replyGopls(c *Conn, req *Request) error {
+	if req.Method == "workspace/configuration" {
+		var params struct {
+			Items []json.RawMessage `json:"items"`
+		}
+		json.Unmarshal(req.Params, &params)
+		return c.Reply(req, make([]interface{}, len(params.Items)), nil)
+	}
+	return c.Reply(req, nil, nil)
+}
+
+// stopGopls shuts gopls down, if it was started.
+func (s *Server) stopGopls() {
+	if s.gopls == nil {
+		return
+	}
+	s.gopls.Call("shutdown", nil, nil)
+	s.gopls.Notify("exit", nil)
+	s.goplsClose.Close()
+	s.gopls = nil
+	s.goplsDocs = make(map[string]*goplsDoc)
+}
+
+// process is a subprocess talking through its standard input and output.
+type process struct {
+	io.ReadCloser
+	io.WriteCloser
+	cmd *exec.Cmd
+}
+
+func execGopls() (io.ReadWriteCloser, error) {
+	cmd := exec.Command("gopls")
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &process{ReadCloser: stdout, WriteCloser: stdin, cmd: cmd}, nil
+}
+
+func (p *process) Close() error {
+	p.WriteCloser.Close()
+	return p.cmd.Wait()
+}
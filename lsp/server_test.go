@@ -0,0 +1,272 @@
+package lsp_test
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/titpetric/egon/lsp"
+)
+
+// client is an LSP client connected to a server through pipes.
+type client struct {
+	t     *testing.T
+	conn  *lsp.Conn
+	notes chan *lsp.Request
+}
+
+func newClient(t *testing.T, server *lsp.Server) *client {
+	clientR, serverW := io.Pipe()
+	serverR, clientW := io.Pipe()
+	go server.Serve(serverR, serverW)
+
+	c := &client{t: t, notes: make(chan *lsp.Request, 16)}
+	c.conn = lsp.NewConn(clientR, clientW, func(_ *lsp.Conn, req *lsp.Request) error {
+		c.notes <- req
+		return nil
+	})
+	go c.conn.Run()
+	t.Cleanup(func() {
+		clientW.Close()
+		clientR.Close()
+	})
+
+	assert.NoError(t, c.conn.Call("initialize", map[string]string{"rootUri": "file:///"}, nil))
+	assert.NoError(t, c.conn.Notify("initialized", struct{}{}))
+	return c
+}
+
+// diagnostics waits for the next diagnostics published by the server.
+func (c *client) diagnostics() []lsp.Diagnostic {
+	for {
+		select {
+		case note := <-c.notes:
+			if note.Method != "textDocument/publishDiagnostics" {
+				continue
+			}
+			var params lsp.PublishDiagnosticsParams
+			assert.NoError(c.t, json.Unmarshal(note.Params, &params))
+			return params.Diagnostics
+		case <-time.After(time.Minute):
+			c.t.Fatal("no diagnostics published")
+			return nil
+		}
+	}
+}
+
+func (c *client) open(uri, text string) {
+	assert.NoError(c.t, c.conn.Notify("textDocument/didOpen", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri, "languageId": "egon", "version": 1, "text": text},
+	}))
+}
+
+func position(uri string, line, character int) map[string]interface{} {
+	return map[string]interface{}{
+		"textDocument": map[string]string{"uri": uri},
+		"position":     lsp.Position{Line: line, Character: character},
+	}
+}
+
+// templateURI returns the URI of a template in a new directory.
+func templateURI(t *testing.T) string {
+	dir := filepath.Join(t.TempDir(), "views")
+	assert.NoError(t, os.Mkdir(dir, 0755))
+	return "file://" + filepath.ToSlash(filepath.Join(dir, "page.egon"))
+}
+
+// Ensure that scanner and Go errors are reported at their template
+// positions.
+func TestServer_Diagnostics(t *testing.T) {
+	uri := templateURI(t)
+	c := newClient(t, lsp.NewServer(nil))
+
+	c.open(uri, "<%! name string %>\n<p><%== name %></p>\n<% y := missing %>\n")
+	diagnostics := c.diagnostics()
+	if assert.Len(t, diagnostics, 2) {
+		assert.Equal(t, lsp.Position{Line: 2, Character: 3}, diagnostics[0].Range.Start)
+		assert.Contains(t, diagnostics[0].Message, "y")
+		assert.Equal(t, lsp.Position{Line: 2, Character: 8}, diagnostics[1].Range.Start)
+		assert.Equal(t, "undefined: missing", diagnostics[1].Message)
+	}
+
+	assert.NoError(t, c.conn.Notify("textDocument/didChange", map[string]interface{}{
+		"textDocument":   map[string]interface{}{"uri": uri, "version": 2},
+		"contentChanges": []map[string]string{{"text": "<p>\n<%= name"}},
+	}))
+	diagnostics = c.diagnostics()
+	if assert.Len(t, diagnostics, 1) {
+		assert.Equal(t, lsp.Position{Line: 1}, diagnostics[0].Range.Start)
+		assert.Equal(t, "unexpected EOF", diagnostics[0].Message)
+	}
+}
+
+// Ensure that changes to imported packages are picked up when the client
+// reports them.
+func TestServer_DidChangeWatchedFiles(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go tool not available")
+	}
+
+	root := t.TempDir()
+	assert.NoError(t, os.Mkdir(filepath.Join(root, "models"), 0755))
+	assert.NoError(t, os.Mkdir(filepath.Join(root, "views"), 0755))
+	writeModule(t, root)
+	model := filepath.Join(root, "models", "user.go")
+	assert.NoError(t, os.WriteFile(model, []byte("package models\n\ntype User struct{ Name string }\n"), 0644))
+
+	// Packages are imported from the module of the working directory.
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(root))
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	uri := "file://" + filepath.ToSlash(filepath.Join(root, "views", "page.egon"))
+	c := newClient(t, lsp.NewServer(nil))
+	c.open(uri, "<%% import \"example.com/app/models\" %%><%! u *models.User %>\n<%= u.Email %>\n")
+	diagnostics := c.diagnostics()
+	if assert.Len(t, diagnostics, 1) {
+		assert.Contains(t, diagnostics[0].Message, "Email")
+	}
+
+	assert.NoError(t, os.WriteFile(model, []byte("package models\n\ntype User struct{ Name, Email string }\n"), 0644))
+	assert.NoError(t, c.conn.Notify("workspace/didChangeWatchedFiles", map[string]interface{}{
+		"changes": []map[string]interface{}{{"uri": "file://" + filepath.ToSlash(model), "type": 2}},
+	}))
+	assert.Empty(t, c.diagnostics())
+}
+
+// writeModule writes the go.mod of a module at root that uses the egon
+// package of this source tree, which generated templates import.
+func writeModule(t *testing.T, root string) {
+	egon, err := filepath.Abs("..")
+	assert.NoError(t, err)
+	mod := "module example.com/app\n\n" +
+		"go 1.18\n\n" +
+		"require github.com/titpetric/egon v0.0.0\n\n" +
+		"replace github.com/titpetric/egon => " + strconv.Quote(egon) + "\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "go.mod"), []byte(mod), 0644))
+
+	// The go.sum of egon covers the modules it requires.
+	sum, err := os.ReadFile(filepath.Join(egon, "go.sum"))
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "go.sum"), sum, 0644))
+}
+
+// Ensure that parameters are completed inside code and print blocks.
+func TestServer_Completion(t *testing.T) {
+	uri := templateURI(t)
+	c := newClient(t, lsp.NewServer(nil))
+	c.open(uri, "<%! name string %><%! count int %><%! names []string %>\n<p>na <%= na")
+	c.diagnostics()
+
+	var list lsp.CompletionList
+	assert.NoError(t, c.conn.Call("textDocument/completion", position(uri, 1, 12), &list))
+	assert.Equal(t, []lsp.CompletionItem{
+		{Label: "name", Kind: lsp.CompletionItemKindVariable, Detail: "string"},
+		{Label: "names", Kind: lsp.CompletionItemKindVariable, Detail: "[]string"},
+	}, list.Items)
+
+	assert.NoError(t, c.conn.Call("textDocument/completion", position(uri, 1, 5), &list))
+	assert.Empty(t, list.Items)
+}
+
+// Ensure that hover and definition requests are forwarded to gopls at the
+// position of the generated code, and the results mapped back.
+func TestServer_Gopls(t *testing.T) {
+	uri := templateURI(t)
+	server := lsp.NewServer(nil)
+	server.Gopls = fakeGopls
+	c := newClient(t, server)
+	c.open(uri, "<%! name string %>\n<p><%== name %></p>\n")
+	c.diagnostics()
+
+	var hover struct {
+		Contents string
+		Range    lsp.Range
+	}
+	assert.NoError(t, c.conn.Call("textDocument/hover", position(uri, 1, 10), &hover))
+	assert.Equal(t, "name", hover.Contents)
+	assert.Equal(t, lsp.Range{Start: lsp.Position{Line: 1, Character: 8}, End: lsp.Position{Line: 1, Character: 12}}, hover.Range)
+
+	var locations []lsp.Location
+	assert.NoError(t, c.conn.Call("textDocument/definition", position(uri, 1, 10), &locations))
+	assert.Equal(t, []lsp.Location{{
+		URI:   uri,
+		Range: lsp.Range{Start: lsp.Position{Line: 0, Character: 4}, End: lsp.Position{Line: 0, Character: 8}},
+	}}, locations)
+
+	// Positions outside of Go code aren't forwarded.
+	var result json.RawMessage
+	assert.NoError(t, c.conn.Call("textDocument/hover", position(uri, 1, 1), &result))
+	assert.Equal(t, "null", string(result))
+}
+
+// fakeGopls starts an in-process server that answers hover requests with
+// the identifier at the position, and definition requests with its first
+// occurrence in the document.
+func fakeGopls() (io.ReadWriteCloser, error) {
+	goplsR, serverW := io.Pipe()
+	serverR, goplsW := io.Pipe()
+
+	docs := map[string]string{}
+	word := func(params json.RawMessage) (string, string, lsp.Range) {
+		var p struct {
+			TextDocument struct{ URI string }
+			Position     lsp.Position
+		}
+		json.Unmarshal(params, &p)
+		lines := strings.Split(docs[p.TextDocument.URI], "\n")
+		line := lines[p.Position.Line]
+		start, end := p.Position.Character, p.Position.Character
+		for start > 0 && isWord(line[start-1]) {
+			start--
+		}
+		for end < len(line) && isWord(line[end]) {
+			end++
+		}
+		return p.TextDocument.URI, line[start:end], lsp.Range{
+			Start: lsp.Position{Line: p.Position.Line, Character: start},
+			End:   lsp.Position{Line: p.Position.Line, Character: end},
+		}
+	}
+
+	gopls := lsp.NewConn(goplsR, goplsW, func(c *lsp.Conn, req *lsp.Request) error {
+		switch req.Method {
+		case "textDocument/didOpen":
+			var p struct{ TextDocument struct{ URI, Text string } }
+			json.Unmarshal(req.Params, &p)
+			docs[p.TextDocument.URI] = p.TextDocument.Text
+			return nil
+		case "textDocument/hover":
+			_, w, r := word(req.Params)
+			return c.Reply(req, map[string]interface{}{"contents": w, "range": r}, nil)
+		case "textDocument/definition":
+			uri, w, _ := word(req.Params)
+			for i, line := range strings.Split(docs[uri], "\n") {
+				if j := strings.Index(line, w+" "); j >= 0 {
+					r := lsp.Range{Start: lsp.Position{Line: i, Character: j}, End: lsp.Position{Line: i, Character: j + len(w)}}
+					return c.Reply(req, []lsp.Location{{URI: uri, Range: r}}, nil)
+				}
+			}
+		}
+		return c.Reply(req, nil, nil)
+	})
+	go gopls.Run()
+
+	return struct {
+		io.Reader
+		io.Writer
+		io.Closer
+	}{serverR, serverW, serverW}, nil
+}
+
+func isWord(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
@@ -0,0 +1,264 @@
+package egon
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"go/types"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Segment maps a span of the generated Go code to the template text it was
+// generated from. Offsets are in bytes.
+type Segment struct {
+	Offset    int // start of the span in the generated code
+	SrcOffset int // start of the span in the template
+	Length    int
+}
+
+// WriteMapped writes the template like Write, and returns the segments
+// that map the Go code of its parameter, code and print blocks back to the
+// template, ordered by their offset in the generated code. Only blocks
+// read by the scanner are mapped.
+func (t *Template) WriteMapped(w io.Writer) ([]Segment, error) {
+	m, err := t.write(w)
+	if err != nil {
+		return nil, err
+	}
+	return m.segments, nil
+}
+
+// Check generates the template and type checks it together with the other
+// Go files of its package. The syntax and type errors found are returned as
+// a scanner.ErrorList positioned in the template, or nil if there are none.
+func (t *Template) Check() error {
+	var src bytes.Buffer
+	segments, err := t.WriteMapped(&src)
+	if err != nil {
+		return err
+	}
+
+	var template bytes.Buffer
+	if err := t.WriteSource(&template); err != nil {
+		return err
+	}
+
+	var errs scanner.ErrorList
+	report := func(offset int, msg string) {
+		pos := sourcePosition(template.Bytes(), sourceOffset(segments, offset))
+		pos.Filename = t.Path
+		errs.Add(pos, msg)
+	}
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, t.SourceFile(), src.Bytes(), parser.AllErrors)
+	if list, ok := err.(scanner.ErrorList); ok {
+		for _, e := range list {
+			report(e.Pos.Offset, e.Msg)
+		}
+	}
+	if err != nil || f == nil {
+		errs.Sort()
+		return errs.Err()
+	}
+
+	files := append(packageFiles(fset, filepath.Dir(t.SourceFile()), t.SourceFile(), f.Name.Name), f)
+	conf := types.Config{
+		Importer: t.Config.orDefault().importer(),
+		Error: func(err error) {
+			if err, ok := err.(types.Error); ok && fset.Position(err.Pos).Filename == t.SourceFile() {
+				report(fset.Position(err.Pos).Offset, err.Msg)
+			}
+		},
+	}
+	conf.Check(f.Name.Name, fset, files, &types.Info{Defs: map[*ast.Ident]types.Object{}})
+
+	errs.Sort()
+	return errs.Err()
+}
+
+// GeneratedOffset returns the offset in the generated code of the template
+// offset srcOffset, if it is within a mapped segment.
+func GeneratedOffset(segments []Segment, srcOffset int) (int, bool) {
+	for _, s := range segments {
+		if s.SrcOffset <= srcOffset && srcOffset <= s.SrcOffset+s.Length {
+			return s.Offset + srcOffset - s.SrcOffset, true
+		}
+	}
+	return 0, false
+}
+
+// SourceOffset returns the template offset of the generated code at offset,
+// if it is within a mapped segment.
+func SourceOffset(segments []Segment, offset int) (int, bool) {
+	i := sort.Search(len(segments), func(i int) bool {
+		return segments[i].Offset+segments[i].Length >= offset
+	})
+	if i < len(segments) && segments[i].Offset <= offset {
+		return segments[i].SrcOffset + offset - segments[i].Offset, true
+	}
+	return 0, false
+}
+
+// sourceOffset returns the template offset of the generated code at
+// offset, or the start of the closest segment before it if it isn't mapped.
+func sourceOffset(segments []Segment, offset int) int {
+	if src, ok := SourceOffset(segments, offset); ok {
+		return src
+	}
+	src := 0
+	for _, s := range segments {
+		if s.Offset > offset {
+			break
+		}
+		src = s.SrcOffset
+	}
+	return src
+}
+
+// sourcePosition returns the line and column of offset in src.
+func sourcePosition(src []byte, offset int) token.Position {
+	if offset > len(src) {
+		offset = len(src)
+	}
+	line := bytes.Count(src[:offset], []byte("\n")) + 1
+	column := offset - bytes.LastIndexByte(src[:offset], '\n')
+	return token.Position{Offset: offset, Line: line, Column: column}
+}
+
+// codeMap maps the code generated for a template to the template.
+type codeMap struct {
+	segments []Segment
+	blocks   []blockSpan // the blocks of the template func, in order
+}
+
+// blockSpan is the generated code of a block. srcOffset is the template
+// offset of the block, or -1 if it wasn't read by the scanner.
+type blockSpan struct {
+	offset, end int
+	srcOffset   int
+	source      string
+	pos         Pos
+}
+
+// blockOffsets finds the template offsets of blocks read by the scanner.
+// The blocks are looked up in template order, and may be copies of the
+// template blocks.
+type blockOffsets struct {
+	sources []string
+	offsets []int
+	next    int
+}
+
+func (t *Template) blockOffsets() *blockOffsets {
+	o := &blockOffsets{}
+	offset := 0
+	for _, b := range t.Blocks {
+		src := *blockSource(b)
+		o.sources = append(o.sources, src)
+		o.offsets = append(o.offsets, offset)
+		offset += len(src)
+	}
+	return o
+}
+
+// find returns the template offset of b, which must come after the block
+// found last.
+func (o *blockOffsets) find(b Block) (int, bool) {
+	src := *blockSource(b)
+	if src == "" {
+		return 0, false
+	}
+	for i := o.next; i < len(o.sources); i++ {
+		if o.sources[i] == src {
+			o.next = i + 1
+			return o.offsets[i], true
+		}
+	}
+	return 0, false
+}
+
+// mapBlock returns the segments of the Go code in b, a block at srcOffset
+// in the template whose generated code starts at offset, and which is
+// closed by close. The code is found by writing the block again with a
+// placeholder of the same length.
+func mapBlock(b Block, config *Config, close string, offset, srcOffset int) []Segment {
+	var segments []Segment
+	add := func(content string, replace func(string) Block, srcStart int) {
+		if content == "" || srcStart < 0 {
+			return
+		}
+		placeholder := strings.Repeat("\x00", len(content))
+		var buf bytes.Buffer
+		if err := replace(placeholder).write(&buf, config); err != nil {
+			return
+		}
+		if i := bytes.Index(buf.Bytes(), []byte(placeholder)); i >= 0 {
+			segments = append(segments, Segment{Offset: offset + i, SrcOffset: srcOffset + srcStart, Length: len(content)})
+		}
+	}
+
+	switch b := b.(type) {
+	case *CodeBlock:
+		add(b.Content, func(s string) Block { c := *b; c.Content = s; return &c }, contentStart(b.Source, b.Content, close, b.TrimRight))
+	case *PrintBlock:
+		add(b.Content, func(s string) Block { c := *b; c.Content = s; return &c }, contentStart(b.Source, b.Content, close, b.TrimRight))
+	case *RawPrintBlock:
+		add(b.Content, func(s string) Block { c := *b; c.Content = s; return &c }, contentStart(b.Source, b.Content, close, b.TrimRight))
+	case *TranslateBlock:
+		start := contentStart(b.Source, b.Content, close, b.TrimRight)
+		for i, arg := range b.Args {
+			i := i
+			replace := func(s string) Block {
+				c := *b
+				c.Args = append([]NamedArg(nil), b.Args...)
+				c.Args[i].Expr = s
+				return &c
+			}
+			if start >= 0 {
+				add(arg.Expr, replace, start+arg.offset)
+			}
+		}
+	case *ComponentBlock:
+		start := contentStart(b.Source, b.Content, close, b.TrimRight)
+		for i, arg := range b.Args {
+			i := i
+			replace := func(s string) Block {
+				c := *b
+				c.Args = append([]NamedArg(nil), b.Args...)
+				c.Args[i].Expr = s
+				return &c
+			}
+			if start >= 0 {
+				add(arg.Expr, replace, start+arg.offset)
+			}
+		}
+	case *ParameterBlock:
+		name := strings.Index(b.Source, b.ParamName)
+		add(b.ParamName, func(s string) Block { c := *b; c.ParamName = s; return &c }, name)
+		if name >= 0 {
+			if typ := strings.Index(b.Source[name+len(b.ParamName):], b.ParamType); typ >= 0 {
+				add(b.ParamType, func(s string) Block { c := *b; c.ParamType = s; return &c }, name+len(b.ParamName)+typ)
+			}
+		}
+	}
+	return segments
+}
+
+// contentStart returns the offset of the content of a block in its source,
+// which ends with the closing delimiter and the trim marker, if any.
+func contentStart(source, content, close string, trimRight bool) int {
+	end := len(source) - len(close)
+	if trimRight {
+		end--
+	}
+	if end < len(content) || source[end-len(content):end] != content {
+		return -1
+	}
+	return end - len(content)
+}
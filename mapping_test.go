@@ -0,0 +1,120 @@
+package egon_test
+
+import (
+	"bytes"
+	"go/scanner"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	. "github.com/titpetric/egon"
+)
+
+// Ensure that the segments map the Go code of every block to its text in
+// the template.
+func TestTemplate_WriteMapped(t *testing.T) {
+	src := "<%!  name   string %>\n<%- for i := 0; i < 2; i++ { -%>\n<p><%= name %> <%=d i%> <%== \"<b>\" + name %></p>\n<% } %>"
+	tmpl, err := ParseConfig(bytes.NewBufferString(src), "views/page.egon", &Config{StringOptimisations: true})
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	segments, err := tmpl.WriteMapped(&buf)
+	assert.NoError(t, err)
+
+	var mapped []string
+	for _, s := range segments {
+		assert.Equal(t, src[s.SrcOffset:s.SrcOffset+s.Length], buf.String()[s.Offset:s.Offset+s.Length])
+		mapped = append(mapped, src[s.SrcOffset:s.SrcOffset+s.Length])
+	}
+	assert.Equal(t, []string{"name", "string", " for i := 0; i < 2; i++ { ", " name ", "i", " \"<b>\" + name ", " } "}, mapped)
+
+	name := strings.Index(src, "<%= name") + len("<%= ")
+	offset, ok := GeneratedOffset(segments, name)
+	assert.True(t, ok)
+	assert.Equal(t, "name", buf.String()[offset:offset+4])
+	back, ok := SourceOffset(segments, offset)
+	assert.True(t, ok)
+	assert.Equal(t, name, back)
+}
+
+// Ensure that the Go errors of a template are reported at their template
+// positions.
+func TestTemplate_Check(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "views")
+	assert.NoError(t, os.Mkdir(dir, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "user.go"), []byte("package views\n\ntype User struct{ Name string }\n"), 0644))
+
+	path := filepath.Join(dir, "page.egon")
+	tmpl, err := Parse(bytes.NewBufferString("<%! u *User %>\n<p><%== u.Nmae %></p>\n"), path)
+	assert.NoError(t, err)
+
+	err = tmpl.Check()
+	if assert.IsType(t, scanner.ErrorList{}, err) {
+		errs := err.(scanner.ErrorList)
+		assert.Len(t, errs, 1)
+		assert.Equal(t, path, errs[0].Pos.Filename)
+		assert.Equal(t, 2, errs[0].Pos.Line)
+		assert.Equal(t, 11, errs[0].Pos.Column)
+		assert.Contains(t, errs[0].Msg, "Nmae")
+	}
+
+	tmpl, err = Parse(bytes.NewBufferString("<%! u *User %>\n<p><%== u.Name %></p>\n"), path)
+	assert.NoError(t, err)
+	assert.NoError(t, tmpl.Check())
+}
+
+// Ensure that blocks with other delimiters are mapped.
+func TestTemplate_WriteMappedDelims(t *testing.T) {
+	src := "<%# egon:delims [[ ]] #%>\n<p>[[= name ]]</p>[[! name string ]]"
+	tmpl, err := Parse(bytes.NewBufferString(src), "views/page.egon")
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	segments, err := tmpl.WriteMapped(&buf)
+	assert.NoError(t, err)
+	var mapped []string
+	for _, s := range segments {
+		mapped = append(mapped, src[s.SrcOffset:s.SrcOffset+s.Length])
+	}
+	assert.Equal(t, []string{"name", "string", " name "}, mapped)
+}
+
+// Ensure that the arguments of translation blocks are mapped.
+func TestTemplate_WriteMappedTranslate(t *testing.T) {
+	src := "<%! ctx context.Context %><%t \"{a} {b}\" a=x.A b=f(y) %>"
+	tmpl, err := Parse(bytes.NewBufferString(src), "views/page.egon")
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	segments, err := tmpl.WriteMapped(&buf)
+	assert.NoError(t, err)
+	var mapped, generated []string
+	for _, s := range segments {
+		mapped = append(mapped, src[s.SrcOffset:s.SrcOffset+s.Length])
+		generated = append(generated, buf.String()[s.Offset:s.Offset+s.Length])
+	}
+	assert.Equal(t, []string{"ctx", "context.Context", "x.A", "f(y)"}, mapped)
+	assert.Equal(t, mapped, generated)
+}
+
+// Ensure that the arguments of component blocks are mapped.
+func TestTemplate_WriteMappedComponent(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "views")
+	writeTemplates(t, dir, map[string]string{"icon.egon": "<%! name string %><%! size int %>"})
+	src := "<%@ component Icon size=n + 1 name=x.Name / %>"
+	tmpl, err := Parse(bytes.NewBufferString(src), filepath.Join(dir, "page.egon"))
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	segments, err := tmpl.WriteMapped(&buf)
+	assert.NoError(t, err)
+	var mapped, generated []string
+	for _, s := range segments {
+		mapped = append(mapped, src[s.SrcOffset:s.SrcOffset+s.Length])
+		generated = append(generated, buf.String()[s.Offset:s.Offset+s.Length])
+	}
+	assert.Equal(t, []string{"n + 1", "x.Name"}, mapped)
+	assert.Equal(t, mapped, generated)
+}
@@ -0,0 +1,263 @@
+package egon
+
+import (
+	"strings"
+)
+
+// minifyState is the position of the minifier within the HTML document.
+type minifyState int
+
+const (
+	minifyText    minifyState = iota // between tags
+	minifyTag                        // inside a tag, outside attribute values
+	minifyQuote                      // inside a quoted attribute value
+	minifyComment                    // inside a comment
+	minifyKept                       // inside a comment that is kept
+	minifyRaw                        // inside an element whose contents are kept as-is
+)
+
+// rawElements are the elements whose contents are never minified.
+var rawElements = map[string]bool{
+	"pre":      true,
+	"textarea": true,
+	"script":   true,
+	"style":    true,
+}
+
+// Minifier removes comments and redundant whitespace from HTML. The
+// document is given piece by piece, as the static text of a template is
+// split by dynamic blocks, and the minifier keeps track of elements, tags
+// and attribute values across the pieces.
+//
+// Runs of whitespace are collapsed to a single space, except inside pre,
+// textarea, script and style elements and inside attribute values. Quotes
+// are removed from attribute values when it is safe to do so. Comments
+// that run past the end of a piece hold dynamic output, and are kept as
+// they are, so output commented out in the template stays commented out.
+type Minifier struct {
+	state   minifyState
+	quote   byte   // quote of the current attribute value
+	rawTag  string // name of the raw element opened by the current tag
+	rawEnd  string // closing tag of the current raw element, e.g. "</pre"
+	space   bool   // whitespace was seen and not yet written
+	trailed bool   // the last byte written was collapsed whitespace
+}
+
+// NewMinifier returns a Minifier positioned at the start of a document.
+func NewMinifier() *Minifier {
+	return &Minifier{}
+}
+
+// Break marks that dynamic output may appear between the previous piece of
+// text and the next one, so whitespace is not merged across it.
+func (m *Minifier) Break() {
+	m.trailed = false
+}
+
+// Minify minifies the next piece of the document.
+func (m *Minifier) Minify(s string) string {
+	var out strings.Builder
+	out.Grow(len(s))
+
+	// space records whitespace, unless the previous piece ended with it.
+	space := func() {
+		if !m.trailed {
+			m.space = true
+		}
+	}
+	// write writes c, preceded by pending whitespace.
+	write := func(c byte) {
+		if m.space {
+			out.WriteByte(' ')
+			m.space = false
+		}
+		out.WriteByte(c)
+		m.trailed = false
+	}
+
+	for i := 0; i < len(s); {
+		switch m.state {
+		case minifyRaw:
+			j := indexFold(s[i:], m.rawEnd)
+			if j < 0 {
+				out.WriteString(s[i:])
+				i = len(s)
+				break
+			}
+			out.WriteString(s[i : i+j])
+			i += j
+			m.state = minifyText
+
+		case minifyComment:
+			j := strings.Index(s[i:], "-->")
+			if j < 0 {
+				i = len(s)
+				break
+			}
+			i += j + len("-->")
+			m.state = minifyText
+
+		case minifyKept:
+			j := strings.Index(s[i:], "-->")
+			if j < 0 {
+				out.WriteString(s[i:])
+				i = len(s)
+				break
+			}
+			out.WriteString(s[i : i+j+len("-->")])
+			i += j + len("-->")
+			m.state = minifyText
+
+		case minifyQuote:
+			j := strings.IndexByte(s[i:], m.quote)
+			if j < 0 {
+				out.WriteString(s[i:])
+				i = len(s)
+				break
+			}
+			out.WriteString(s[i : i+j+1])
+			i += j + 1
+			m.state = minifyTag
+
+		case minifyTag:
+			c := s[i]
+			switch {
+			case isHTMLSpace(c):
+				space()
+				i++
+			case c == '>':
+				m.space = false
+				m.trailed = false
+				out.WriteByte(c)
+				i++
+				m.state = minifyText
+				if m.rawTag != "" {
+					m.state = minifyRaw
+					m.rawEnd = "</" + m.rawTag
+					m.rawTag = ""
+				}
+			case c == '"' || c == '\'':
+				if value, n, ok := unquoteAttr(s[i:]); ok && i > 0 && s[i-1] == '=' {
+					write(value[0])
+					out.WriteString(value[1:])
+					i += n
+					break
+				}
+				write(c)
+				i++
+				m.quote = c
+				m.state = minifyQuote
+			default:
+				write(c)
+				i++
+			}
+
+		case minifyText:
+			c := s[i]
+			switch {
+			case isHTMLSpace(c):
+				space()
+				i++
+			case strings.HasPrefix(s[i:], "<!--") && !strings.HasPrefix(s[i:], "<!--["):
+				m.state = minifyComment
+				if !strings.Contains(s[i+len("<!--"):], "-->") {
+					write('<')
+					out.WriteString("!--")
+					m.state = minifyKept
+				}
+				i += len("<!--")
+			case c == '<' && i+1 < len(s) && isTagStart(s[i+1]):
+				name := tagName(s[i+1:])
+				write('<')
+				out.WriteString(name)
+				i += 1 + len(name)
+				m.rawTag = ""
+				if rawElements[strings.ToLower(name)] {
+					m.rawTag = strings.ToLower(name)
+				}
+				m.state = minifyTag
+			default:
+				write(c)
+				i++
+			}
+		}
+	}
+
+	// Whitespace at the end of the piece is written out, as dynamic
+	// output may follow it.
+	if m.space && (m.state == minifyText || m.state == minifyTag) {
+		out.WriteByte(' ')
+		m.space = false
+		m.trailed = true
+	}
+	return out.String()
+}
+
+// minifyBlocks returns a copy of blocks with the text blocks minified.
+func minifyBlocks(blocks []Block) []Block {
+	m := NewMinifier()
+	out := make([]Block, len(blocks))
+	for i, b := range blocks {
+		switch b := b.(type) {
+		case *TextBlock:
+			out[i] = &TextBlock{Pos: b.Pos, Content: m.Minify(b.Content)}
+			continue
+		case *CommentBlock:
+		default:
+			m.Break()
+		}
+		out[i] = b
+	}
+	return out
+}
+
+// unquoteAttr returns the attribute value quoted at the start of s without
+// its quotes, and the length of the quoted value, if the value is complete
+// and can be written without quotes.
+func unquoteAttr(s string) (string, int, bool) {
+	end := strings.IndexByte(s[1:], s[0])
+	if end <= 0 {
+		return "", 0, false
+	}
+	value := s[1 : end+1]
+	if strings.ContainsAny(value, " \t\n\f\r\"'=<>`") {
+		return "", 0, false
+	}
+	// A slash right after the value would become part of it.
+	if rest := s[end+2:]; rest == "" || rest[0] == '/' {
+		return "", 0, false
+	}
+	return value, end + 2, true
+}
+
+// tagName returns the name at the start of a tag, including a leading slash
+// for closing tags.
+func tagName(s string) string {
+	i := 0
+	if i < len(s) && (s[i] == '/' || s[i] == '!' || s[i] == '?') {
+		i++
+	}
+	for i < len(s) && !isHTMLSpace(s[i]) && s[i] != '>' && s[i] != '/' {
+		i++
+	}
+	return s[:i]
+}
+
+// indexFold returns the index of the first ASCII case-insensitive match of
+// substr in s, or -1.
+func indexFold(s, substr string) int {
+	for i := 0; i+len(substr) <= len(s); i++ {
+		if strings.EqualFold(s[i:i+len(substr)], substr) {
+			return i
+		}
+	}
+	return -1
+}
+
+func isTagStart(c byte) bool {
+	return c == '/' || c == '!' || c == '?' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func isHTMLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\f' || c == '\r'
+}
@@ -0,0 +1,88 @@
+package egon_test
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	. "github.com/titpetric/egon"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+// minifyTemplate returns the static text of the template at path after
+// minification, with the dynamic blocks shown as {{.}}.
+func minifyTemplate(t *testing.T, path string) string {
+	tmpl, err := ParseFile(path)
+	if !assert.NoError(t, err) {
+		return ""
+	}
+
+	var buf bytes.Buffer
+	m := NewMinifier()
+	for _, b := range tmpl.Blocks {
+		switch b := b.(type) {
+		case *TextBlock:
+			buf.WriteString(m.Minify(b.Content))
+		case *CommentBlock, *HeaderBlock, *ParameterBlock:
+		default:
+			m.Break()
+			buf.WriteString("{{.}}")
+		}
+	}
+	return buf.String()
+}
+
+// Ensure that the templates in testdata/minify minify to their golden files.
+func TestMinifier_Corpus(t *testing.T) {
+	paths, err := filepath.Glob("testdata/minify/*.egon")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, paths)
+
+	for _, path := range paths {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			got := minifyTemplate(t, path)
+			golden := strings.TrimSuffix(path, ".egon") + ".golden"
+			if *update {
+				assert.NoError(t, os.WriteFile(golden, []byte(got), 0644))
+			}
+			want, err := os.ReadFile(golden)
+			assert.NoError(t, err)
+			assert.Equal(t, string(want), got)
+		})
+	}
+}
+
+// Ensure that multi-byte runes survive minification.
+func TestMinifier_UTF8(t *testing.T) {
+	m := NewMinifier()
+	assert.Equal(t, "<p> Čaša ☕ </p>", m.Minify("<p>\n  Čaša   ☕\n</p>"))
+}
+
+// Ensure that whitespace before dynamic output is kept in place.
+func TestMinifier_Break(t *testing.T) {
+	m := NewMinifier()
+	assert.Equal(t, "Hello ", m.Minify("Hello   "))
+	m.Break()
+	assert.Equal(t, " ! ", m.Minify("  !  "))
+	assert.Equal(t, "", m.Minify("   "))
+}
+
+// Ensure that comments holding dynamic output are kept, so the output stays
+// commented out.
+func TestMinifier_DynamicComment(t *testing.T) {
+	m := NewMinifier()
+	assert.Equal(t, "<p>hi</p> <!--  debug ", m.Minify("<p>hi</p>  <!--  debug "))
+	m.Break()
+	assert.Equal(t, " --> <p>x</p>", m.Minify(" -->  <p>x</p>"))
+	assert.Equal(t, "<p>y</p>", m.Minify("<!-- static --><p>y</p>"))
+
+	tmpl, err := ParseConfig(strings.NewReader("<p>hi</p><!-- debug <%= secret %> --><p>x</p>"), "/tmp/views/page.egon", &Config{Minify: true})
+	assert.NoError(t, err)
+	assert.Contains(t, tmpl.String(), `[]byte("<p>hi</p><!-- debug ")`)
+	assert.Contains(t, tmpl.String(), `[]byte(" --><p>x</p>")`)
+}
@@ -0,0 +1,117 @@
+package egon
+
+import (
+	"bytes"
+	"fmt"
+	"go/constant"
+	"go/token"
+	"go/types"
+	"html"
+	"strings"
+)
+
+// optimizeBlocks returns a copy of blocks prepared for code generation:
+// comments, directives other than children and empty code blocks are
+// dropped, print blocks of constant strings are folded into text, and
+// adjacent text blocks are merged. Text blocks are always copied, so the
+// result can be modified freely.
+func optimizeBlocks(blocks []Block) []Block {
+	var out []Block
+	for _, b := range blocks {
+		switch b := b.(type) {
+		case *CommentBlock:
+			continue
+		case *DirectiveBlock:
+			if b.Name != "children" {
+				continue
+			}
+		case *CodeBlock:
+			if strings.TrimSpace(b.Content) == "" {
+				continue
+			}
+		case *RawPrintBlock:
+			if s, ok := constantString(b.Content); ok {
+				out = appendText(out, b.Pos, s)
+				continue
+			}
+		case *PrintBlock:
+			if b.Type == 0 || b.Type == 's' {
+				if s, ok := constantString(b.Content); ok {
+					out = appendText(out, b.Pos, html.EscapeString(s))
+					continue
+				}
+			}
+		case *TextBlock:
+			out = appendText(out, b.Pos, b.Content)
+			// Keep the source of the first text that isn't blank, so the
+			// text can be found in the template.
+			last := out[len(out)-1].(*TextBlock)
+			if strings.TrimSpace(last.Source) == "" {
+				last.Source = b.Source
+			}
+			continue
+		}
+		out = append(out, b)
+	}
+	return out
+}
+
+// appendText appends text to blocks, merging it into the last block if
+// that is a text block.
+func appendText(blocks []Block, pos Pos, text string) []Block {
+	if len(blocks) > 0 {
+		if last, ok := blocks[len(blocks)-1].(*TextBlock); ok {
+			last.Content += text
+			return blocks
+		}
+	}
+	return append(blocks, &TextBlock{Pos: pos, Content: text})
+}
+
+// constantString returns the value of expr if it is a constant string
+// expression, such as a string literal or a concatenation of them.
+func constantString(expr string) (string, bool) {
+	tv, err := types.Eval(token.NewFileSet(), nil, token.NoPos, expr)
+	if err != nil || tv.Value == nil || tv.Value.Kind() != constant.String {
+		return "", false
+	}
+	return constant.StringVal(tv.Value), true
+}
+
+// staticText names the text blocks, which are written out as package
+// level byte slices. Blocks with the same content share a name. The
+// returned contents are indexed by the number in the name.
+func (t *Template) staticText(blocks []Block) []string {
+	var texts []string
+	names := map[string]string{}
+	for _, b := range blocks {
+		b, ok := b.(*TextBlock)
+		if !ok || b.Content == "" {
+			continue
+		}
+		name, ok := names[b.Content]
+		if !ok {
+			name = t.staticTextName(len(texts))
+			names[b.Content] = name
+			texts = append(texts, b.Content)
+		}
+		b.ident = name
+	}
+	return texts
+}
+
+func (t *Template) staticTextName(i int) string {
+	return fmt.Sprintf("egon%sText%d", t.Name(), i)
+}
+
+// writeStaticText declares the static text of the template.
+func (t *Template) writeStaticText(buf *bytes.Buffer, texts []string) {
+	if len(texts) == 0 {
+		return
+	}
+	buf.WriteString("var (\n")
+	for i, text := range texts {
+		fmt.Fprintf(buf, "%s = []byte(%q)\n", t.staticTextName(i), text)
+	}
+	buf.WriteString(")\n\n")
+}
@@ -21,9 +21,28 @@ func (p *Package) Write() error {
 		return err
 	}
 
-	if err := p.Template.Write(f); err != nil {
-		return fmt.Errorf("template: %s: %s", p.Template.Path, err)
+	if !p.Template.Config.orDefault().SourceMap {
+		if err := p.Template.Write(f); err != nil {
+			return fmt.Errorf("template: %s: %s", p.Template.Path, err)
+		}
+		// A source map left from an earlier run no longer matches.
+		if err := os.Remove(p.Template.SourceMapFile()); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
 	}
 
-	return nil
+	m, err := p.Template.WriteSourceMap(f)
+	if err != nil {
+		return fmt.Errorf("template: %s: %s", p.Template.Path, err)
+	}
+	mf, err := os.Create(p.Template.SourceMapFile())
+	if err != nil {
+		return err
+	}
+	if err := m.Write(mf); err != nil {
+		mf.Close()
+		return err
+	}
+	return mf.Close()
 }
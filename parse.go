@@ -1,34 +1,60 @@
 package egon
 
 import (
+	"go/scanner"
+	"go/token"
 	"io"
 	"os"
 )
 
 // Parse parses an Ego template from a reader.
 // The path specifies the path name used in the compiled template's pragmas.
+// Scanning errors are returned as a *scanner.Error positioned at the start
+// of the offending block.
 func Parse(r io.Reader, path string) (*Template, error) {
-	s := NewScanner(r, path)
-	t := &Template{Path: path}
+	return ParseConfig(r, path, nil)
+}
+
+// ParseConfig parses an Ego template from a reader with a given
+// configuration.
+func ParseConfig(r io.Reader, path string, config *Config) (*Template, error) {
+	s := NewScannerConfig(r, path, config)
+	t := &Template{Path: path, Config: config}
 	for {
+		pos := s.pos
 		b, err := s.Scan()
 		if err == io.EOF {
 			break
 		} else if err != nil {
-			return nil, err
+			return nil, scanError(pos, err)
 		}
 		t.Blocks = append(t.Blocks, b)
 	}
+	t.Delims = s.Delims()
 	t.normalize()
 	return t, nil
 }
 
+// scanError wraps an error returned by Scan for the block at pos.
+func scanError(pos Pos, err error) error {
+	return &scanner.Error{
+		Pos: token.Position{Filename: pos.Path, Line: pos.LineNo},
+		Msg: err.Error(),
+	}
+}
+
 // ParseFile parses an Ego template from a file.
 func ParseFile(path string) (*Template, error) {
+	return ParseFileConfig(path, nil)
+}
+
+// ParseFileConfig parses an Ego template from a file with a given
+// configuration.
+func ParseFileConfig(path string, config *Config) (*Template, error) {
 	f, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
 	defer f.Close()
-	return Parse(f, path)
+	return ParseConfig(f, path, config)
 }
@@ -0,0 +1,80 @@
+package egon_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	. "github.com/titpetric/egon"
+)
+
+// Ensure that trim markers remove the indentation and newline around
+// control flow lines.
+func TestParseTrimMarkers(t *testing.T) {
+	src := "<ul>\n  <%- for _, x := range xs { -%>\n  <li><%= x %></li>\n  <%- } -%>\n</ul>\n"
+	tmpl, err := Parse(bytes.NewBufferString(src), "tmpl.egon")
+	assert.NoError(t, err)
+
+	var text []string
+	for _, b := range tmpl.Blocks {
+		if b, ok := b.(*TextBlock); ok {
+			text = append(text, b.Content)
+		}
+	}
+	assert.Equal(t, []string{"<ul>\n", "  <li>", "</li>\n", "</ul>\n"}, text)
+}
+
+// Ensure that raw regions are read as text, which trim markers don't trim.
+func TestParseRaw(t *testing.T) {
+	src := "<% if ok { -%><%raw%>\n<%= x %> %>\n<%endraw%>\n<%- } %>"
+	tmpl, err := Parse(bytes.NewBufferString(src), "tmpl.egon")
+	assert.NoError(t, err)
+	if assert.Len(t, tmpl.Blocks, 3) {
+		if b, ok := tmpl.Blocks[1].(*TextBlock); assert.True(t, ok) {
+			assert.Equal(t, "\n<%= x %> %>\n\n", b.Content)
+		}
+	}
+
+	_, err = Parse(bytes.NewBufferString("<%raw%><%= x %>"), "tmpl.egon")
+	assert.Error(t, err)
+}
+
+// Ensure that parsed templates are written back out byte for byte.
+func TestTemplate_WriteSource(t *testing.T) {
+	sources := []string{
+		"<%%  import \"strings\" %%>\r\n<%!  name   string %>\n<%# a #1 comment #%>\n" +
+			"<ul>\n  <%- for _, x := range xs { -%>\n  <li><%=x%> <%=d  len(x)%> <%=f.2 1.5 %></li>\n  <%- } -%>\n</ul>\n" +
+			"<%-== strings.ToUpper(name) -%>\n<p>ünïcode < 3 <<%= 1 %>",
+		"trailing <",
+		"<%raw%><%= x %>\n<%endraw%>",
+	}
+	paths, err := filepath.Glob("testdata/*/*.egon")
+	assert.NoError(t, err)
+	for _, path := range paths {
+		src, err := os.ReadFile(path)
+		assert.NoError(t, err)
+		sources = append(sources, string(src))
+	}
+
+	for _, src := range sources {
+		tmpl, err := ParseConfig(bytes.NewBufferString(src), "tmpl.egon", &Config{StringOptimisations: true})
+		assert.NoError(t, err)
+
+		var buf bytes.Buffer
+		assert.NoError(t, tmpl.WriteSource(&buf))
+		assert.Equal(t, src, buf.String())
+	}
+}
+
+// Ensure that blocks without a source are written in their canonical form.
+func TestTemplate_WriteSourceNewBlocks(t *testing.T) {
+	tmpl, err := Parse(bytes.NewBufferString("<p><%=x%></p>"), "tmpl.egon")
+	assert.NoError(t, err)
+	tmpl.Blocks = append(tmpl.Blocks[:2], &RawPrintBlock{Content: "y", TrimRight: true}, tmpl.Blocks[2])
+
+	var buf bytes.Buffer
+	assert.NoError(t, tmpl.WriteSource(&buf))
+	assert.Equal(t, "<p><%=x%><%== y -%></p>", buf.String())
+}
@@ -12,8 +12,8 @@ type Pos struct {
 	LineNo int
 }
 
-func (p *Pos) write(buf *bytes.Buffer) {
-	if Config.Debug && p != nil && p.Path != "" && p.LineNo > 0 {
+func (p *Pos) write(buf *bytes.Buffer, config *Config) {
+	if config.Debug && p != nil && p.Path != "" && p.LineNo > 0 {
 		fmt.Fprintf(buf, "//line %s:%d\n", filepath.Base(p.Path), p.LineNo)
 	}
 }
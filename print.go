@@ -0,0 +1,140 @@
+package egon
+
+import (
+	"io"
+	"strconv"
+	"sync"
+
+	"github.com/titpetric/egon/locale"
+)
+
+// Scratch is a reusable buffer that generated templates format values into
+// before writing them out, so printing numbers doesn't allocate.
+type Scratch struct {
+	B [64]byte
+}
+
+var scratchPool = sync.Pool{
+	New: func() interface{} { return new(Scratch) },
+}
+
+// NewScratch returns a scratch buffer from a pool.
+func NewScratch() *Scratch {
+	return scratchPool.Get().(*Scratch)
+}
+
+// Release returns the scratch buffer to the pool.
+func (s *Scratch) Release() {
+	scratchPool.Put(s)
+}
+
+// Signed, Unsigned and Float are the types of the values written by the
+// print blocks with the 'd', 'u', and 'f' or 'g' format codes. Number is
+// any of them, for the 'n' format code.
+type (
+	Signed interface {
+		~int | ~int8 | ~int16 | ~int32 | ~int64
+	}
+	Unsigned interface {
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr
+	}
+	Float interface {
+		~float32 | ~float64
+	}
+	Number interface {
+		Signed | Unsigned | Float
+	}
+)
+
+// AppendInt appends the decimal form of v to dst. Only signed integers are
+// accepted, so a print block can't truncate a float or wrap an unsigned
+// value around by accident.
+func AppendInt[T Signed](dst []byte, v T) []byte {
+	return strconv.AppendInt(dst, int64(v), 10)
+}
+
+// AppendUint appends the decimal form of v to dst.
+func AppendUint[T Unsigned](dst []byte, v T) []byte {
+	return strconv.AppendUint(dst, uint64(v), 10)
+}
+
+// AppendFloat appends v to dst like strconv.AppendFloat does with the
+// format fmt and precision prec.
+func AppendFloat[T Float](dst []byte, v T, fmt byte, prec int) []byte {
+	return strconv.AppendFloat(dst, float64(v), fmt, prec, 64)
+}
+
+// AppendNumber appends v to dst with the conventions of the locale l, with
+// decimals digits after the decimal separator, or as many as needed if
+// decimals is negative.
+func AppendNumber[T Number](l *locale.Locale, dst []byte, v T, decimals int) []byte {
+	return l.AppendNumber(dst, float64(v), decimals)
+}
+
+var (
+	escapedAmp  = []byte("&amp;")
+	escapedApos = []byte("&#39;")
+	escapedLt   = []byte("&lt;")
+	escapedGt   = []byte("&gt;")
+	escapedQuot = []byte("&#34;")
+)
+
+// escaped returns the HTML entity for c, or nil if c needs no escaping. The
+// entities match those of html.EscapeString.
+func escaped(c byte) []byte {
+	switch c {
+	case '&':
+		return escapedAmp
+	case '\'':
+		return escapedApos
+	case '<':
+		return escapedLt
+	case '>':
+		return escapedGt
+	case '"':
+		return escapedQuot
+	}
+	return nil
+}
+
+// EscapeString writes s to w with HTML special characters escaped, without
+// building an escaped copy of s. It doesn't allocate if w implements
+// io.StringWriter.
+func EscapeString(w io.Writer, s string) error {
+	last := 0
+	for i := 0; i < len(s); i++ {
+		entity := escaped(s[i])
+		if entity == nil {
+			continue
+		}
+		if _, err := io.WriteString(w, s[last:i]); err != nil {
+			return err
+		}
+		if _, err := w.Write(entity); err != nil {
+			return err
+		}
+		last = i + 1
+	}
+	_, err := io.WriteString(w, s[last:])
+	return err
+}
+
+// Escape writes b to w with HTML special characters escaped.
+func Escape(w io.Writer, b []byte) error {
+	last := 0
+	for i, c := range b {
+		entity := escaped(c)
+		if entity == nil {
+			continue
+		}
+		if _, err := w.Write(b[last:i]); err != nil {
+			return err
+		}
+		if _, err := w.Write(entity); err != nil {
+			return err
+		}
+		last = i + 1
+	}
+	_, err := w.Write(b[last:])
+	return err
+}
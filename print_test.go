@@ -0,0 +1,133 @@
+package egon_test
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"html"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	. "github.com/titpetric/egon"
+)
+
+const escapeInput = `<a href="/users?id=1&sort=name">O'Reilly & "friends"</a> plain text follows`
+
+// Ensure that escaping matches html.EscapeString.
+func TestEscapeString(t *testing.T) {
+	for _, s := range []string{"", "plain", escapeInput, "<<>>", "ünïcødé & ☕"} {
+		var buf bytes.Buffer
+		assert.NoError(t, EscapeString(&buf, s))
+		assert.Equal(t, html.EscapeString(s), buf.String())
+
+		buf.Reset()
+		assert.NoError(t, Escape(&buf, []byte(s)))
+		assert.Equal(t, html.EscapeString(s), buf.String())
+	}
+}
+
+// Ensure that escaping and printing numbers don't allocate.
+func TestPrintAllocs(t *testing.T) {
+	var buf bytes.Buffer
+	buf.Grow(1024)
+	allocs := testing.AllocsPerRun(100, func() {
+		buf.Reset()
+		EscapeString(&buf, escapeInput)
+		s := NewScratch()
+		buf.Write(AppendInt(s.B[:0], 123456))
+		buf.Write(AppendFloat(s.B[:0], 3.14159, 'f', 2))
+		s.Release()
+	})
+	assert.Equal(t, 0.0, allocs)
+}
+
+func BenchmarkEscapeString(b *testing.B) {
+	var buf bytes.Buffer
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		EscapeString(&buf, escapeInput)
+	}
+}
+
+func BenchmarkHTMLEscapeString(b *testing.B) {
+	var buf bytes.Buffer
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		io.WriteString(&buf, html.EscapeString(escapeInput))
+	}
+}
+
+func BenchmarkPrintIntScratch(b *testing.B) {
+	var buf bytes.Buffer
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		s := NewScratch()
+		buf.Write(AppendInt(s.B[:0], i))
+		s.Release()
+	}
+}
+
+func BenchmarkPrintIntSprintf(b *testing.B) {
+	var buf bytes.Buffer
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		io.WriteString(&buf, html.EscapeString(fmt.Sprintf("%d", i)))
+	}
+}
+
+func BenchmarkPrintFloatScratch(b *testing.B) {
+	var buf bytes.Buffer
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		s := NewScratch()
+		buf.Write(AppendFloat(s.B[:0], float64(i)/7, 'f', 2))
+		s.Release()
+	}
+}
+
+func BenchmarkPrintFloatSprintf(b *testing.B) {
+	var buf bytes.Buffer
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		io.WriteString(&buf, html.EscapeString(fmt.Sprintf("%.2f", float64(i)/7)))
+	}
+}
+
+// Ensure that the numeric format codes only compile for values of their
+// kind, so a value can't be truncated or wrapped around by a conversion.
+func TestPrintBlock_NumericKinds(t *testing.T) {
+	fset := token.NewFileSet()
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	check := func(code, typ string) error {
+		src := fmt.Sprintf(`<%%%% import "context" %%%%><%%! ctx context.Context %%><%%! x %s %%><%%=%s x %%>`, typ, code)
+		tmpl, err := ParseConfig(strings.NewReader(src), "views/kinds.egon", &Config{StringOptimisations: true})
+		if !assert.NoError(t, err) {
+			return nil
+		}
+		f, err := parser.ParseFile(fset, "kinds.egon.go", tmpl.String(), 0)
+		if !assert.NoError(t, err) {
+			return nil
+		}
+		_, err = conf.Check("views", fset, []*ast.File{f}, nil)
+		return err
+	}
+
+	for _, c := range [][2]string{{"d", "int64"}, {"d", "rune"}, {"u", "uint8"}, {"f.2", "float32"}, {"g", "float64"}, {"n", "int"}, {"n.2", "float64"}} {
+		assert.NoError(t, check(c[0], c[1]), "%s %s", c[0], c[1])
+	}
+	for _, c := range [][2]string{{"d", "float64"}, {"d", "uint"}, {"u", "int"}, {"f", "int"}, {"g", "int64"}, {"n", "string"}} {
+		assert.Error(t, check(c[0], c[1]), "%s %s", c[0], c[1])
+	}
+}
@@ -0,0 +1,71 @@
+package egon
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ViewFactory creates a view from template arguments, given in the order
+// the template declares its parameters.
+type ViewFactory func(args ...interface{}) (*View, error)
+
+// ArgumentError is returned by a ViewFactory when the arguments don't match
+// the parameters of the template.
+type ArgumentError struct {
+	Name  string // registered name of the template
+	Param string // parameter name, empty if the argument count is wrong
+	Type  string // parameter type
+	Want  int    // number of parameters
+	Got   int    // number of arguments
+}
+
+func (e *ArgumentError) Error() string {
+	if e.Param == "" {
+		return fmt.Sprintf("egon: %s: expected %d arguments, got %d", e.Name, e.Want, e.Got)
+	}
+	return fmt.Sprintf("egon: %s: argument %s must be of type %s", e.Name, e.Param, e.Type)
+}
+
+var registry = struct {
+	sync.RWMutex
+	views map[string]ViewFactory
+}{views: make(map[string]ViewFactory)}
+
+// Register makes a view factory available by name. Generated templates
+// register themselves from an init function. If Register is called twice
+// with the same name it panics.
+func Register(name string, factory ViewFactory) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	if factory == nil {
+		panic("egon: Register factory is nil")
+	}
+	if _, dup := registry.views[name]; dup {
+		panic("egon: Register called twice for view " + name)
+	}
+	registry.views[name] = factory
+}
+
+// Lookup returns the view factory registered with name.
+func Lookup(name string) (ViewFactory, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	factory, ok := registry.views[name]
+	return factory, ok
+}
+
+// Views returns a sorted list of the registered view names.
+func Views() []string {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	names := make([]string, 0, len(registry.views))
+	for name := range registry.views {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
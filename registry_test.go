@@ -0,0 +1,42 @@
+package egon_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	. "github.com/titpetric/egon"
+)
+
+// Ensure that a registered view can be looked up by name.
+func TestRegistry_Lookup(t *testing.T) {
+	Register("registry/test", func(args ...interface{}) (*View, error) {
+		name := args[0].(string)
+		return &View{RenderFunc: func(w io.Writer) error {
+			_, err := io.WriteString(w, "hello "+name)
+			return err
+		}}, nil
+	})
+
+	factory, ok := Lookup("registry/test")
+	if assert.True(t, ok) {
+		view, err := factory("world")
+		assert.NoError(t, err)
+
+		var buf bytes.Buffer
+		assert.NoError(t, view.Render(&buf))
+		assert.Equal(t, "hello world", buf.String())
+	}
+	assert.Contains(t, Views(), "registry/test")
+
+	_, ok = Lookup("registry/missing")
+	assert.False(t, ok)
+}
+
+// Ensure that registering a name twice panics.
+func TestRegistry_RegisterTwice(t *testing.T) {
+	factory := func(args ...interface{}) (*View, error) { return nil, nil }
+	Register("registry/twice", factory)
+	assert.Panics(t, func() { Register("registry/twice", factory) })
+}
@@ -0,0 +1,44 @@
+package egon
+
+import (
+	"fmt"
+	"io"
+)
+
+// HTML is a fragment of HTML that is known to be safe. Print blocks write
+// it without escaping.
+type HTML string
+
+// URL is a URL that is known to be safe. Print blocks write it without
+// escaping.
+type URL string
+
+// JS is JavaScript code that is known to be safe. Print blocks write it
+// without escaping.
+type JS string
+
+// CSS is a stylesheet or style declaration that is known to be safe. Print
+// blocks write it without escaping.
+type CSS string
+
+// Print writes v to w as a print block does: values of the HTML, URL, JS
+// and CSS types are written as they are, anything else is formatted with
+// fmt and HTML escaped.
+func Print(w io.Writer, v interface{}) error {
+	var err error
+	switch v := v.(type) {
+	case HTML:
+		_, err = io.WriteString(w, string(v))
+	case URL:
+		_, err = io.WriteString(w, string(v))
+	case JS:
+		_, err = io.WriteString(w, string(v))
+	case CSS:
+		_, err = io.WriteString(w, string(v))
+	case string:
+		err = EscapeString(w, v)
+	default:
+		err = EscapeString(w, fmt.Sprint(v))
+	}
+	return err
+}
@@ -0,0 +1,32 @@
+package egon_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	. "github.com/titpetric/egon"
+)
+
+// Ensure that safe types are printed as they are and everything else is
+// escaped.
+func TestPrint(t *testing.T) {
+	var buf bytes.Buffer
+	for _, v := range []interface{}{
+		HTML("<b>"), URL("/?a=1&b=2"), JS("a<b"), CSS("a>b"), "<i>", 42, []string{"<"},
+	} {
+		assert.NoError(t, Print(&buf, v))
+	}
+	assert.Equal(t, "<b>/?a=1&b=2a<ba>b&lt;i&gt;42[&lt;]", buf.String())
+}
+
+// Ensure that type inference writes safe types without escaping.
+func TestTemplate_WriteInfersSafeTypes(t *testing.T) {
+	tmpl, err := ParseFileConfig("testdata/safe/page.egon", &Config{Typesafe: true})
+	assert.NoError(t, err)
+
+	out := tmpl.String()
+	assert.Contains(t, out, "egon.EscapeString(w,  title )")
+	assert.Contains(t, out, "io.WriteString(w, string( body ))")
+	assert.Contains(t, out, "io.WriteString(w, string( link ))")
+}
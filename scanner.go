@@ -4,52 +4,114 @@ import (
 	"bufio"
 	"bytes"
 	"io"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
 // Scanner is a tokenizer for Ego templates.
 type Scanner struct {
-	r   *bufio.Reader
-	pos Pos
+	r        *bufio.Reader
+	pos      Pos
+	config   *Config
+	delims   Delims
+	first    bool
+	trimLeft bool
+
+	// raw holds the text read for the current block, and last the last
+	// rune in it.
+	raw  bytes.Buffer
+	last rune
 }
 
 // NewScanner initializes a new scanner with a given reader.
 func NewScanner(r io.Reader, path string) *Scanner {
+	return NewScannerConfig(r, path, nil)
+}
+
+// NewScannerConfig initializes a new scanner with a given reader and
+// configuration.
+func NewScannerConfig(r io.Reader, path string, config *Config) *Scanner {
 	return &Scanner{
 		r: bufio.NewReader(r),
 		pos: Pos{
 			Path:   path,
 			LineNo: 1,
 		},
+		config: config.orDefault(),
+		delims: config.orDefault().delims(),
+		first:  true,
 	}
 }
 
+// Delims returns the delimiters the scanner reads blocks with, which an
+// "egon:delims" directive in the first block may have changed.
+func (s *Scanner) Delims() Delims {
+	return s.delims
+}
+
 // Scan returns the next block from the reader.
 func (s *Scanner) Scan() (Block, error) {
-	ch, err := s.read()
+	s.raw.Reset()
+	if _, err := s.r.Peek(1); err != nil {
+		return nil, err
+	}
+
+	var (
+		b   Block
+		err error
+	)
+	if s.skip(s.delims.Open) {
+		b, err = s.scanCodeBlock()
+	} else {
+		b, err = s.scanTextBlock()
+	}
 	if err != nil {
 		return nil, err
 	}
+	*blockSource(b) = s.raw.String()
 
-	if ch == '<' {
-		return s.scanBlock()
+	if s.first {
+		s.first = false
+		if c, ok := b.(*CommentBlock); ok {
+			if err := s.directive(c.Content); err != nil {
+				return nil, err
+			}
+		}
 	}
-	return s.scanTextBlock(string(ch))
+	return b, nil
 }
 
-func (s *Scanner) scanBlock() (Block, error) {
-	ch, err := s.read()
-	if err == io.EOF {
-		return &TextBlock{Content: "<", Pos: s.pos}, nil
-	} else if err != nil {
-		return nil, err
-	} else if ch == '%' {
-		return s.scanCodeBlock()
+// directive applies an "egon:delims open close" directive, given in the
+// comment that starts a template.
+func (s *Scanner) directive(comment string) error {
+	fields := strings.Fields(comment)
+	if len(fields) == 0 || fields[0] != "egon:delims" {
+		return nil
+	}
+	if len(fields) != 3 {
+		return ErrDelimsFormat
+	}
+	s.delims = Delims{Open: fields[1], Close: fields[2]}
+	return nil
+}
+
+// skip reads delim if the reader is at it.
+func (s *Scanner) skip(delim string) bool {
+	if next, _ := s.r.Peek(len(delim)); string(next) != delim {
+		return false
 	}
-	return s.scanTextBlock(string('<') + string(ch))
+	for range delim {
+		s.read()
+	}
+	return true
 }
 
 func (s *Scanner) scanCodeBlock() (Block, error) {
+	if s.skip("raw" + s.delims.Close) {
+		return s.scanRawBlock()
+	}
+
 	ch, err := s.read()
 	if err == io.EOF {
 		return nil, io.ErrUnexpectedEOF
@@ -57,6 +119,17 @@ func (s *Scanner) scanCodeBlock() (Block, error) {
 		return nil, err
 	}
 
+	// A leading "-" trims the indentation before the block.
+	s.trimLeft = ch == '-'
+	if s.trimLeft {
+		ch, err = s.read()
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
 	// Check the next character to see if it's a special type of block.
 	switch ch {
 	case '!':
@@ -65,6 +138,14 @@ func (s *Scanner) scanCodeBlock() (Block, error) {
 		return s.scanCommentBlock()
 	case '%':
 		return s.scanHeaderBlock()
+	case '@':
+		return s.scanDirectiveBlock()
+	case 't':
+		if next, _ := s.r.Peek(64); isTranslation(next) {
+			return s.scanTranslateBlock()
+		}
+		// The "t" can't be unread after peeking, so it starts the code.
+		return s.scanCode("t")
 	case '=':
 		ch, err := s.read()
 		if err == io.EOF {
@@ -83,32 +164,50 @@ func (s *Scanner) scanCodeBlock() (Block, error) {
 
 	// Otherwise read the contents of the code block.
 	s.unread()
-	b := &CodeBlock{Pos: s.pos}
+	return s.scanCode("")
+}
+
+// scanCode reads the contents of a code block, which start with prefix.
+func (s *Scanner) scanCode(prefix string) (Block, error) {
+	b := &CodeBlock{Pos: s.pos, TrimLeft: s.trimLeft}
 	content, err := s.scanContent()
 	if err != nil {
 		return nil, err
 	}
-	b.Content = content
+	b.Content, b.TrimRight = trimRightMarker(prefix + content)
 
 	return b, nil
 }
 
+// scanRawBlock reads the text of a <%raw%>...<%endraw%> region, which is
+// written out as it is.
+func (s *Scanner) scanRawBlock() (Block, error) {
+	b := &TextBlock{Pos: s.pos, Raw: true}
+	content, err := s.scanUntil(s.delims.Open + "endraw" + s.delims.Close)
+	if err != nil {
+		return nil, err
+	}
+	b.Content = content
+	return b, nil
+}
+
 func (s *Scanner) scanCommentBlock() (Block, error) {
-	b := &CommentBlock{Pos: s.pos}
+	b := &CommentBlock{Pos: s.pos, TrimLeft: s.trimLeft}
 	content, err := s.scanCommentContent()
 	if err != nil {
 		return nil, err
 	}
-	b.Content = content
+	b.Content, b.TrimRight = trimRightMarker(content)
 	return b, nil
 }
 
 func (s *Scanner) scanParameterBlock() (Block, error) {
-	b := &ParameterBlock{Pos: s.pos}
+	b := &ParameterBlock{Pos: s.pos, TrimLeft: s.trimLeft}
 	content, err := s.scanContent()
 	if err != nil {
 		return nil, err
 	}
+	content, b.TrimRight = trimRightMarker(content)
 
 	fields := strings.Fields(content)
 	if len(fields) < 2 {
@@ -120,37 +219,68 @@ func (s *Scanner) scanParameterBlock() (Block, error) {
 	return b, nil
 }
 
+func (s *Scanner) scanDirectiveBlock() (Block, error) {
+	content, err := s.scanContent()
+	if err != nil {
+		return nil, err
+	}
+	content, trimRight := trimRightMarker(content)
+
+	switch fields := strings.Fields(content); {
+	case len(fields) > 0 && fields[0] == "component":
+		b := &ComponentBlock{Pos: s.pos, Content: content, TrimLeft: s.trimLeft, TrimRight: trimRight}
+		b.Name, b.Args, b.SelfClosing, err = parseComponent(content)
+		if err != nil {
+			return nil, err
+		}
+		return b, nil
+	case len(fields) == 1 && fields[0] == "end":
+		return &EndBlock{Pos: s.pos, TrimLeft: s.trimLeft, TrimRight: trimRight}, nil
+	}
+
+	b := &DirectiveBlock{Pos: s.pos, Content: content, TrimLeft: s.trimLeft, TrimRight: trimRight}
+	b.Name, b.Args, err = parseDirective(b.Content)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
 func (s *Scanner) scanHeaderBlock() (Block, error) {
-	b := &HeaderBlock{Pos: s.pos}
+	b := &HeaderBlock{Pos: s.pos, TrimLeft: s.trimLeft}
 	content, err := s.scanHeaderContent()
 	if err != nil {
 		return nil, err
 	}
-	b.Content = content
+	b.Content, b.TrimRight = trimRightMarker(content)
 	return b, nil
 }
 
 func (s *Scanner) scanRawPrintBlock() (Block, error) {
-	b := &RawPrintBlock{Pos: s.pos}
+	b := &RawPrintBlock{Pos: s.pos, TrimLeft: s.trimLeft}
 	content, err := s.scanContent()
 	if err != nil {
 		return nil, err
 	}
-	b.Content = content
+	b.Content, b.TrimRight = trimRightMarker(content)
 	return b, nil
 }
 
 func (s *Scanner) scanPrintBlock() (Block, error) {
-	b := &PrintBlock{Pos: s.pos}
+	b := &PrintBlock{Pos: s.pos, Precision: -1, TrimLeft: s.trimLeft}
 	content, err := s.scanContent()
 	if err != nil {
 		return nil, err
 	}
+	content, b.TrimRight = trimRightMarker(content)
 
-	if Config.StringOptimisations {
-		if len(content) > 2 && content[1] == ' ' {
+	if s.config.StringOptimisations {
+		if len(content) > 2 && isFormatCode(content[0]) && content[1] == ' ' {
 			b.Type = content[0]
 			content = content[2:]
+		} else if typ, precision, n := scanPrecision(content); n > 0 {
+			b.Type, b.Precision = typ, precision
+			content = content[n:]
 		}
 	}
 
@@ -158,17 +288,33 @@ func (s *Scanner) scanPrintBlock() (Block, error) {
 	return b, nil
 }
 
-func (s *Scanner) scanTextBlock(prefix string) (Block, error) {
-	buf := bytes.NewBufferString(prefix)
+func (s *Scanner) scanTranslateBlock() (Block, error) {
+	b := &TranslateBlock{Pos: s.pos, TrimLeft: s.trimLeft}
+	content, err := s.scanContent()
+	if err != nil {
+		return nil, err
+	}
+	b.Content, b.TrimRight = trimRightMarker(content)
+	b.Message, b.Plural, b.Args, err = parseTranslation(b.Content)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (s *Scanner) scanTextBlock() (Block, error) {
+	var buf bytes.Buffer
 	b := &TextBlock{Pos: s.pos}
 
 	for {
+		if next, _ := s.r.Peek(len(s.delims.Open)); string(next) == s.delims.Open {
+			break
+		}
 		ch, err := s.read()
 		if err == io.EOF {
 			break
-		} else if ch == '<' {
-			s.unread()
-			break
+		} else if err != nil {
+			return nil, err
 		}
 		buf.WriteRune(ch)
 	}
@@ -178,94 +324,71 @@ func (s *Scanner) scanTextBlock(prefix string) (Block, error) {
 	return b, nil
 }
 
-// scans the reader until %> is reached.
+// scans the reader until the closing delimiter is reached.
 func (s *Scanner) scanContent() (string, error) {
-	var buf bytes.Buffer
-	for {
-		ch, err := s.read()
-		if err == io.EOF {
-			return "", io.ErrUnexpectedEOF
-		} else if ch == '%' {
-			ch, err := s.read()
-			if err == io.EOF {
-				return "", io.ErrUnexpectedEOF
-			} else if ch == '>' {
-				break
-			} else {
-				buf.WriteRune('%')
-				buf.WriteRune(ch)
-			}
-		} else {
-			buf.WriteRune(ch)
-		}
-	}
-	return string(buf.Bytes()), nil
+	return s.scanUntil(s.delims.Close)
 }
 
-// scans the reader until %%> is reached.
+// scans the reader until "%" and the closing delimiter are reached.
 func (s *Scanner) scanHeaderContent() (string, error) {
-	var buf bytes.Buffer
-	for {
-		ch, err := s.read()
-		if err == io.EOF {
-			return "", io.ErrUnexpectedEOF
-		} else if ch == '%' {
-			ch, err := s.read()
-			if err == io.EOF {
-				return "", io.ErrUnexpectedEOF
-			} else if ch == '%' {
-				ch, err := s.read()
-				if err == io.EOF {
-					return "", io.ErrUnexpectedEOF
-				} else if ch == '>' {
-					break
-				} else {
-					buf.WriteRune('%')
-					buf.WriteRune('%')
-					buf.WriteRune(ch)
-				}
-			} else {
-				buf.WriteRune('%')
-				buf.WriteRune(ch)
-			}
-		} else {
-			buf.WriteRune(ch)
-		}
-	}
-	return string(buf.Bytes()), nil
+	return s.scanUntil("%" + s.delims.Close)
 }
 
-// scans the reader until #%> is reached.
+// scans the reader until "#" and the closing delimiter are reached.
 func (s *Scanner) scanCommentContent() (string, error) {
+	return s.scanUntil("#" + s.delims.Close)
+}
+
+// scanUntil reads up to and including the closing delimiter end, and
+// returns the text before it.
+func (s *Scanner) scanUntil(end string) (string, error) {
 	var buf bytes.Buffer
-	for {
+	for !bytes.HasSuffix(buf.Bytes(), []byte(end)) {
 		ch, err := s.read()
 		if err == io.EOF {
 			return "", io.ErrUnexpectedEOF
-		} else if ch == '#' {
-			ch, err := s.read()
-			if err == io.EOF {
-				return "", io.ErrUnexpectedEOF
-			} else if ch == '%' {
-				ch, err := s.read()
-				if err == io.EOF {
-					return "", io.ErrUnexpectedEOF
-				} else if ch == '>' {
-					break
-				} else {
-					buf.WriteRune('#')
-					buf.WriteRune('%')
-					buf.WriteRune(ch)
-				}
-			} else {
-				buf.WriteRune('%')
-				buf.WriteRune(ch)
-			}
-		} else {
-			buf.WriteRune(ch)
+		} else if err != nil {
+			return "", err
 		}
+		buf.WriteRune(ch)
 	}
-	return string(buf.Bytes()), nil
+	return string(buf.Bytes()[:buf.Len()-len(end)]), nil
+}
+
+// scanPrecision reads a format code with a precision, such as "f.2 ", from
+// the start of content. It returns the code, the precision and the length
+// of the format, or a zero length if there is none.
+func scanPrecision(content string) (byte, int, int) {
+	if len(content) < 4 || (content[0] != 'f' && content[0] != 'g' && content[0] != 'n') || content[1] != '.' {
+		return 0, 0, 0
+	}
+	i := 2
+	for i < len(content) && '0' <= content[i] && content[i] <= '9' {
+		i++
+	}
+	if i == 2 || i >= len(content) || content[i] != ' ' {
+		return 0, 0, 0
+	}
+	precision, err := strconv.Atoi(content[2:i])
+	if err != nil {
+		return 0, 0, 0
+	}
+	return content[0], precision, i + 1
+}
+
+// isFormatCode returns whether c can be the format code of a print block,
+// which is an ASCII letter like the fmt verbs.
+func isFormatCode(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// trimRightMarker strips a trailing "-" from block content, which trims the
+// newline following the block.
+func trimRightMarker(content string) (string, bool) {
+	if strings.HasSuffix(content, "-") {
+		return content[:len(content)-1], true
+	}
+	return content, false
 }
 
 func (s *Scanner) read() (rune, error) {
@@ -273,9 +396,18 @@ func (s *Scanner) read() (rune, error) {
 	if ch == '\n' {
 		s.pos.LineNo++
 	}
+	if err == nil {
+		s.raw.WriteRune(ch)
+		s.last = ch
+	}
 	return ch, err
 }
 
 func (s *Scanner) unread() {
 	s.r.UnreadRune()
+	s.raw.Truncate(s.raw.Len() - utf8.RuneLen(s.last))
+	if s.last == '\n' {
+		s.pos.LineNo--
+	}
+	s.last = 0
 }
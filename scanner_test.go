@@ -198,3 +198,171 @@ func TestScannerEOF(t *testing.T) {
 	assert.Equal(t, err, io.EOF)
 	assert.Nil(t, b)
 }
+
+// Ensure that trim markers are recognised on either side of a block.
+func TestScannerTrimMarkers(t *testing.T) {
+	s := NewScanner(bytes.NewBufferString(`<%- x := 1 -%><%-= x %><%== x -%>`), "tmpl.egon")
+	b, err := s.Scan()
+	assert.NoError(t, err)
+	if b, ok := b.(*CodeBlock); assert.True(t, ok) {
+		assert.Equal(t, ` x := 1 `, b.Content)
+		assert.True(t, b.TrimLeft)
+		assert.True(t, b.TrimRight)
+	}
+
+	b, err = s.Scan()
+	assert.NoError(t, err)
+	if b, ok := b.(*PrintBlock); assert.True(t, ok) {
+		assert.Equal(t, ` x `, b.Content)
+		assert.True(t, b.TrimLeft)
+		assert.False(t, b.TrimRight)
+	}
+
+	b, err = s.Scan()
+	assert.NoError(t, err)
+	if b, ok := b.(*RawPrintBlock); assert.True(t, ok) {
+		assert.Equal(t, ` x `, b.Content)
+		assert.False(t, b.TrimLeft)
+		assert.True(t, b.TrimRight)
+	}
+}
+
+// Ensure that a trim marker followed by EOF returns an error.
+func TestScannerTrimMarkerUnexpectedEOF(t *testing.T) {
+	s := NewScanner(bytes.NewBufferString(`<%-`), "tmpl.egon")
+	_, err := s.Scan()
+	assert.Equal(t, err, io.ErrUnexpectedEOF)
+}
+
+// Ensure that a print block format code can carry a precision.
+func TestScannerPrintBlockPrecision(t *testing.T) {
+	config := &Config{StringOptimisations: true}
+	s := NewScannerConfig(bytes.NewBufferString(`<%=f.2 price %><%=d n %><%= x %>`), "tmpl.egon", config)
+	b, err := s.Scan()
+	assert.NoError(t, err)
+	if b, ok := b.(*PrintBlock); assert.True(t, ok) {
+		assert.Equal(t, byte('f'), b.Type)
+		assert.Equal(t, 2, b.Precision)
+		assert.Equal(t, `price `, b.Content)
+	}
+
+	b, err = s.Scan()
+	assert.NoError(t, err)
+	if b, ok := b.(*PrintBlock); assert.True(t, ok) {
+		assert.Equal(t, byte('d'), b.Type)
+		assert.Equal(t, -1, b.Precision)
+		assert.Equal(t, `n `, b.Content)
+	}
+
+	b, err = s.Scan()
+	assert.NoError(t, err)
+	if b, ok := b.(*PrintBlock); assert.True(t, ok) {
+		assert.Equal(t, byte(0), b.Type)
+		assert.Equal(t, ` x `, b.Content)
+	}
+}
+
+// Ensure that "#" and "%" inside a comment are kept as they are.
+func TestScannerCommentBlock(t *testing.T) {
+	s := NewScanner(bytes.NewBufferString(`<%# 50% #1 ##%>`), "tmpl.egon")
+	b, err := s.Scan()
+	assert.NoError(t, err)
+	if b, ok := b.(*CommentBlock); assert.True(t, ok) {
+		assert.Equal(t, ` 50% #1 #`, b.Content)
+	}
+}
+
+// Ensure that a block is closed by the first closing delimiter, even right
+// after another "%".
+func TestScannerClosingDelimiter(t *testing.T) {
+	s := NewScanner(bytes.NewBufferString(`<% x %%><%% y %%%>`), "tmpl.egon")
+	b, err := s.Scan()
+	assert.NoError(t, err)
+	if b, ok := b.(*CodeBlock); assert.True(t, ok) {
+		assert.Equal(t, ` x %`, b.Content)
+	}
+
+	b, err = s.Scan()
+	assert.NoError(t, err)
+	if b, ok := b.(*HeaderBlock); assert.True(t, ok) {
+		assert.Equal(t, ` y %`, b.Content)
+	}
+}
+
+// Ensure that a newline read ahead of a print block isn't counted twice.
+func TestScannerPrintBlockNewline(t *testing.T) {
+	s := NewScanner(bytes.NewBufferString("<%=\nx %><%= y %>"), "tmpl.egon")
+	b, _ := s.Scan()
+	assert.Equal(t, Pos{Path: "tmpl.egon", LineNo: 1}, b.(*PrintBlock).Pos)
+	b, _ = s.Scan()
+	assert.Equal(t, Pos{Path: "tmpl.egon", LineNo: 2}, b.(*PrintBlock).Pos)
+}
+
+// Ensure that only letters are read as print block format codes.
+func TestScannerPrintBlockFormatCode(t *testing.T) {
+	config := &Config{StringOptimisations: true}
+	s := NewScannerConfig(bytes.NewBufferString(`<%=( x) %>`), "tmpl.egon", config)
+	b, err := s.Scan()
+	assert.NoError(t, err)
+	if b, ok := b.(*PrintBlock); assert.True(t, ok) {
+		assert.Equal(t, byte(0), b.Type)
+		assert.Equal(t, `( x) `, b.Content)
+	}
+}
+
+// Ensure that blocks can be opened and closed with other delimiters.
+func TestScannerDelims(t *testing.T) {
+	config := &Config{Delims: Delims{Open: "{%", Close: "%}"}}
+	s := NewScannerConfig(bytes.NewBufferString(`<% x %>{%-= y -%}{%# a % #%}`), "tmpl.egon", config)
+	b, err := s.Scan()
+	assert.NoError(t, err)
+	if b, ok := b.(*TextBlock); assert.True(t, ok) {
+		assert.Equal(t, `<% x %>`, b.Content)
+	}
+
+	b, err = s.Scan()
+	assert.NoError(t, err)
+	if b, ok := b.(*PrintBlock); assert.True(t, ok) {
+		assert.Equal(t, ` y `, b.Content)
+		assert.True(t, b.TrimLeft)
+		assert.True(t, b.TrimRight)
+	}
+
+	b, err = s.Scan()
+	assert.NoError(t, err)
+	if b, ok := b.(*CommentBlock); assert.True(t, ok) {
+		assert.Equal(t, ` a % `, b.Content)
+	}
+}
+
+// Ensure that a directive in the first block changes the delimiters.
+func TestScannerDelimsDirective(t *testing.T) {
+	s := NewScanner(bytes.NewBufferString("<%# egon:delims [[ ]] #%>\n<% x %>[[= y ]]"), "tmpl.egon")
+	b, err := s.Scan()
+	assert.NoError(t, err)
+	assert.IsType(t, &CommentBlock{}, b)
+	assert.Equal(t, Delims{Open: "[[", Close: "]]"}, s.Delims())
+
+	b, err = s.Scan()
+	assert.NoError(t, err)
+	if b, ok := b.(*TextBlock); assert.True(t, ok) {
+		assert.Equal(t, "\n<% x %>", b.Content)
+	}
+
+	b, err = s.Scan()
+	assert.NoError(t, err)
+	if b, ok := b.(*PrintBlock); assert.True(t, ok) {
+		assert.Equal(t, ` y `, b.Content)
+		assert.Equal(t, Pos{Path: "tmpl.egon", LineNo: 2}, b.Pos)
+	}
+
+	// Only the first block can change the delimiters.
+	s = NewScanner(bytes.NewBufferString("\n<%# egon:delims [[ ]] #%>"), "tmpl.egon")
+	s.Scan()
+	s.Scan()
+	assert.Equal(t, DefaultDelims, s.Delims())
+
+	s = NewScanner(bytes.NewBufferString("<%# egon:delims [[ #%>"), "tmpl.egon")
+	_, err = s.Scan()
+	assert.Equal(t, ErrDelimsFormat, err)
+}
@@ -0,0 +1,205 @@
+package egon
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"go/token"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SourceMapVersion is the version of the source map format.
+const SourceMapVersion = 1
+
+// SourceMap maps lines and columns of the Go code generated for a template
+// to the template. It is written next to the generated code as
+// "foo.egon.map.json" when Config.SourceMap is set.
+type SourceMap struct {
+	Version  int       `json:"version"`
+	File     string    `json:"file"`     // the generated file
+	Sum      string    `json:"sum"`      // the SHA-256 of the generated file, in hex
+	Template string    `json:"template"` // the template file
+	Mappings []Mapping `json:"mappings"` // ordered by line and column
+}
+
+// Mapping maps a span of a generated line to the template. Lines and
+// columns are 1-based, and columns count bytes.
+//
+// A mapping with a Length copies Go code from the template verbatim, so
+// every column within it has a template column. A mapping without one maps
+// the whole line to the start of the block that generated it.
+type Mapping struct {
+	Line      int `json:"line"`
+	Column    int `json:"column"`
+	Length    int `json:"length,omitempty"`
+	SrcLine   int `json:"srcLine"`
+	SrcColumn int `json:"srcColumn"`
+}
+
+// SourceMapFile returns the path of the source map of the template.
+func (t *Template) SourceMapFile() string {
+	return t.Path + ".map.json"
+}
+
+// WriteSourceMap writes the template like Write, and returns the source map
+// of the generated code.
+func (t *Template) WriteSourceMap(w io.Writer) (*SourceMap, error) {
+	var gen bytes.Buffer
+	m, err := t.write(&gen)
+	if err != nil {
+		return nil, err
+	}
+	var src bytes.Buffer
+	if err := t.WriteSource(&src); err != nil {
+		return nil, err
+	}
+
+	sm := &SourceMap{
+		Version:  SourceMapVersion,
+		File:     filepath.Base(t.SourceFile()),
+		Sum:      sourceSum(gen.Bytes()),
+		Template: filepath.Base(t.Path),
+	}
+
+	// Go code copied from the template, split into lines.
+	for _, s := range m.segments {
+		for i := 0; i < s.Length; {
+			n := bytes.IndexByte(gen.Bytes()[s.Offset+i:s.Offset+s.Length], '\n')
+			if n < 0 {
+				n = s.Length - i
+			}
+			if n > 0 {
+				pos := sourcePosition(gen.Bytes(), s.Offset+i)
+				srcPos := sourcePosition(src.Bytes(), s.SrcOffset+i)
+				sm.Mappings = append(sm.Mappings, Mapping{Line: pos.Line, Column: pos.Column, Length: n, SrcLine: srcPos.Line, SrcColumn: srcPos.Column})
+			}
+			i += n + 1
+		}
+	}
+
+	// Every line generated by a block, mapped to the block. Text blocks are
+	// mapped to the start of their text, after any leading whitespace.
+	mapped := map[int]bool{}
+	for _, b := range m.blocks {
+		if b.end <= b.offset {
+			continue
+		}
+		srcPos := token.Position{Line: b.pos.LineNo, Column: 1}
+		if b.srcOffset >= 0 {
+			text := strings.TrimLeft(b.source, " \t\r\n")
+			if text == "" {
+				text = b.source
+			}
+			srcPos = sourcePosition(src.Bytes(), b.srcOffset+len(b.source)-len(text))
+		}
+		if srcPos.Line == 0 {
+			continue
+		}
+		first := sourcePosition(gen.Bytes(), b.offset).Line
+		last := sourcePosition(gen.Bytes(), b.end-1).Line
+		for line := first; line <= last; line++ {
+			if !mapped[line] {
+				mapped[line] = true
+				sm.Mappings = append(sm.Mappings, Mapping{Line: line, Column: 1, SrcLine: srcPos.Line, SrcColumn: srcPos.Column})
+			}
+		}
+	}
+
+	sort.SliceStable(sm.Mappings, func(i, j int) bool {
+		a, b := sm.Mappings[i], sm.Mappings[j]
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+
+	if _, err := gen.WriteTo(w); err != nil {
+		return nil, err
+	}
+	return sm, nil
+}
+
+// sourceSum returns the Sum of a source map of the generated code gen.
+func sourceSum(gen []byte) string {
+	sum := sha256.Sum256(gen)
+	return hex.EncodeToString(sum[:])
+}
+
+// Matches returns whether m is the source map of the generated code gen.
+func (m *SourceMap) Matches(gen []byte) bool {
+	return m.Sum == sourceSum(gen)
+}
+
+// LoadSourceMap reads the source map at path. The Template path is made
+// relative to the directory of the source map, so it can be opened as is.
+func LoadSourceMap(path string) (*SourceMap, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	m, err := ReadSourceMap(f)
+	if err != nil {
+		return nil, err
+	}
+	if !filepath.IsAbs(m.Template) {
+		m.Template = filepath.Join(filepath.Dir(path), m.Template)
+	}
+	if !filepath.IsAbs(m.File) {
+		m.File = filepath.Join(filepath.Dir(path), m.File)
+	}
+	return m, nil
+}
+
+// ReadSourceMap reads a source map from r.
+func ReadSourceMap(r io.Reader) (*SourceMap, error) {
+	m := &SourceMap{}
+	if err := json.NewDecoder(r).Decode(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Write writes the source map to w as JSON.
+func (m *SourceMap) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(m)
+}
+
+// Position returns the template position of the generated code at line and
+// column, or of the block that generated the line if column is 0. It
+// returns false if the line wasn't generated from the template.
+func (m *SourceMap) Position(line, column int) (token.Position, bool) {
+	i := sort.Search(len(m.Mappings), func(i int) bool {
+		return m.Mappings[i].Line >= line
+	})
+
+	var block *Mapping
+	for ; i < len(m.Mappings) && m.Mappings[i].Line == line; i++ {
+		mapping := &m.Mappings[i]
+		if mapping.Length == 0 {
+			if block == nil {
+				block = mapping
+			}
+			continue
+		}
+		if column > 0 && mapping.Column <= column && column <= mapping.Column+mapping.Length {
+			return token.Position{
+				Filename: m.Template,
+				Line:     mapping.SrcLine,
+				Column:   mapping.SrcColumn + column - mapping.Column,
+			}, true
+		}
+	}
+	if block == nil {
+		return token.Position{}, false
+	}
+	return token.Position{Filename: m.Template, Line: block.SrcLine, Column: block.SrcColumn}, true
+}
@@ -0,0 +1,77 @@
+package egon_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	. "github.com/titpetric/egon"
+)
+
+// Ensure that the source map written with the generated code maps its
+// lines and columns back to the template.
+func TestSourceMap(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "views")
+	assert.NoError(t, os.Mkdir(dir, 0755))
+	path := filepath.Join(dir, "page.egon")
+	src := "<%! name string %>\n<h1>Title</h1>\n<%- if name != \"\" { -%>\n  <p><%= strings.ToUpper(name) %></p>\n<%- } -%>\n"
+	tmpl, err := ParseConfig(bytes.NewBufferString(src), path, &Config{SourceMap: true})
+	assert.NoError(t, err)
+	assert.NoError(t, (&Package{Template: tmpl}).Write())
+
+	m, err := LoadSourceMap(filepath.Join(dir, "page.egon.map.json"))
+	assert.NoError(t, err)
+	assert.Equal(t, path, m.Template)
+	assert.Equal(t, path+".go", m.File)
+
+	gen, err := os.ReadFile(m.File)
+	assert.NoError(t, err)
+	assert.True(t, m.Matches(gen))
+	assert.False(t, m.Matches(append(gen, "// edited\n"...)))
+	lines := strings.Split(string(gen), "\n")
+	find := func(s string) (int, int) {
+		for i, line := range lines {
+			if j := strings.Index(line, s); j >= 0 {
+				return i + 1, j + 1
+			}
+		}
+		t.Fatalf("%q not generated", s)
+		return 0, 0
+	}
+
+	// Go code maps to its column in the template.
+	line, column := find("strings.ToUpper(name)")
+	pos, ok := m.Position(line, column+len("strings.ToUpper("))
+	assert.True(t, ok)
+	assert.Equal(t, path, pos.Filename)
+	assert.Equal(t, 4, pos.Line)
+	assert.Equal(t, strings.Index("  <p><%= strings.ToUpper(name)", "name")+1, pos.Column)
+
+	line, column = find("name != \"\"")
+	pos, ok = m.Position(line, column)
+	assert.True(t, ok)
+	assert.Equal(t, 3, pos.Line)
+	assert.Equal(t, 8, pos.Column)
+
+	// Other generated lines map to the block they were generated from, text
+	// blocks to their first line of text.
+	line, _ = find("egonPageText0)")
+	pos, ok = m.Position(line, 0)
+	assert.True(t, ok)
+	assert.Equal(t, 2, pos.Line)
+	assert.Equal(t, 1, pos.Column)
+
+	line, _ = find("package views")
+	_, ok = m.Position(line, 1)
+	assert.False(t, ok)
+
+	// Generating without a source map removes the one left from before.
+	tmpl, err = Parse(bytes.NewBufferString(src), path)
+	assert.NoError(t, err)
+	assert.NoError(t, (&Package{Template: tmpl}).Write())
+	_, err = os.Stat(filepath.Join(dir, "page.egon.map.json"))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -15,9 +15,26 @@ import (
 // Template represents an entire Ego template.
 // Templates consist of a set of parameters and other block.
 // Blocks can be either a TextBlock, a PrintBlock, a RawPrintBlock, or a CodeBlock.
+//
+// Root is the folder the template was found in. It is used to derive the
+// name the template registers its view with.
 type Template struct {
 	Path   string
+	Root   string
 	Blocks []Block
+	Config *Config
+
+	// Delims are the delimiters the template was parsed with, the ones of
+	// Config if they are empty.
+	Delims Delims
+}
+
+// delims returns the delimiters of the template.
+func (t *Template) delims() Delims {
+	if t.Delims.Open == "" || t.Delims.Close == "" {
+		return t.Config.orDefault().delims()
+	}
+	return t.Delims
 }
 
 // PackageName returns the name of the package, based on the last non-file
@@ -64,6 +81,37 @@ func (t *Template) Name() string {
 	return name
 }
 
+// contentTypes are the MIME types of template output by file extension. The
+// table is fixed, rather than read from the system, so that generated code
+// doesn't depend on the machine that generates it.
+var contentTypes = map[string]string{
+	"css":  "text/css; charset=utf-8",
+	"csv":  "text/csv; charset=utf-8",
+	"htm":  "text/html; charset=utf-8",
+	"html": "text/html; charset=utf-8",
+	"ics":  "text/calendar; charset=utf-8",
+	"js":   "text/javascript; charset=utf-8",
+	"json": "application/json",
+	"md":   "text/markdown; charset=utf-8",
+	"svg":  "image/svg+xml",
+	"txt":  "text/plain; charset=utf-8",
+	"xml":  "text/xml; charset=utf-8",
+}
+
+// ContentType returns the MIME type of the template output, based on the
+// extension preceding the template extension, e.g. "feed.xml.egon". Templates
+// without such an extension, or with one that isn't known, are assumed to
+// produce HTML.
+func (t *Template) ContentType() string {
+	parts := strings.Split(t.FileName(), ".")
+	if len(parts) > 2 {
+		if contentType, ok := contentTypes[strings.ToLower(parts[len(parts)-2])]; ok {
+			return contentType
+		}
+	}
+	return DefaultContentType
+}
+
 // TemplateFuncName returns the name of the Template func for this template.
 func (t *Template) TemplateFuncName() string {
 	return strings.Join([]string{t.Name(), "Template"}, "")
@@ -74,18 +122,91 @@ func (t *Template) ViewFuncName() string {
 	return strings.Join([]string{t.Name(), "View"}, "")
 }
 
+// RegistryName returns the name the template's view is registered with:
+// the slash separated path of the template relative to Root, without
+// extensions.
+func (t *Template) RegistryName() string {
+	path := t.Path
+	if t.Root != "" {
+		if rel, err := filepath.Rel(t.Root, t.Path); err == nil {
+			path = rel
+		}
+	} else {
+		path = t.FileName()
+	}
+
+	dir, file := filepath.Split(filepath.ToSlash(path))
+	return dir + strings.Split(file, ".")[0]
+}
+
 // SourceFile returns the path to the source file that should be
 // generated from this template.
 func (t *Template) SourceFile() string {
 	return strings.Join([]string{t.Path, ".go"}, "")
 }
 
+// WriteSource writes the template back out as egon source. Blocks are
+// written as their Source, so a parsed template is reproduced byte for
+// byte; blocks without one, such as blocks added by hand, are written in
+// the form used by Format. Source must be cleared when a block is changed.
+func (t *Template) WriteSource(w io.Writer) error {
+	var buf bytes.Buffer
+	for _, b := range t.Blocks {
+		if src := *blockSource(b); src != "" {
+			buf.WriteString(src)
+		} else {
+			formatBlock(&buf, b, t.delims())
+		}
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
+
 // Write writes the template to a writer.
 func (t *Template) Write(w io.Writer) error {
+	_, err := t.write(w)
+	return err
+}
+
+func (t *Template) write(w io.Writer) (*codeMap, error) {
+	config := t.Config.orDefault()
+
+	filters, err := t.filters()
+	if err != nil {
+		return nil, err
+	}
+	blocks, err := t.resolveComponents(applyFilters(optimizeBlocks(t.nonHeaderBlocks()), filters))
+	if err != nil {
+		return nil, err
+	}
+	if config.Typesafe {
+		blocks = t.inferTypes(blocks)
+	}
+	if config.Minify {
+		blocks = minifyBlocks(blocks)
+	}
+	return t.writeBlocks(w, config, blocks)
+}
+
+// writeBlocks writes the template source, with blocks as the body of the
+// template func, and returns the map of the generated code to the template.
+func (t *Template) writeBlocks(w io.Writer, config *Config, blocks []Block) (*codeMap, error) {
 	buf := new(bytes.Buffer)
+	texts := t.staticText(blocks)
 
-	if err := t.writeHeader(buf); err != nil {
-		return err
+	if err := t.writeHeader(buf, config, blocks); err != nil {
+		return nil, err
+	}
+
+	m := &codeMap{}
+	offsets := t.blockOffsets()
+	mapBlocks := func(b Block, start int) {
+		span := blockSpan{offset: start, end: buf.Len(), srcOffset: -1, source: *blockSource(b), pos: blockPos(b)}
+		if offset, ok := offsets.find(b); ok {
+			m.segments = append(m.segments, mapBlock(b, config, t.delims().Close, start, offset)...)
+			span.srcOffset = offset
+		}
+		m.blocks = append(m.blocks, span)
 	}
 
 	params := t.parameterBlocks()
@@ -96,20 +217,49 @@ func (t *Template) Write(w io.Writer) error {
 	ioParam := ParameterBlock{ParamName: "w", ParamType: "io.Writer"}
 	params = append([]*ParameterBlock{&ioParam}, params...)
 	buf.WriteString(fmt.Sprintf("func %s(", t.TemplateFuncName()))
-	t.writeParameters(buf, params)
+	starts := t.writeParameters(buf, params, config)
+	for i, param := range params[1:] {
+		mapBlocks(param, starts[i+1])
+	}
+	offsets.next = 0
 	buf.WriteString(") error {\n")
+	if hasScratchPrintBlock(blocks) {
+		buf.WriteString("egonScratch := egon.NewScratch()\n")
+		buf.WriteString("defer egonScratch.Release()\n")
+	}
+	if b := firstContextBlock(blocks); b != nil {
+		ctx := t.contextParam()
+		if ctx == "" {
+			return nil, scanError(blockPos(b), ErrRenderContext)
+		}
+		fmt.Fprintf(buf, "egonCtx := %s\n", ctx)
+		if hasLocalePrintBlock(blocks) {
+			buf.WriteString("egonLocale := locale.FromContext(egonCtx)\n")
+		}
+	}
 
 	// Write non-header blocks.
-	for _, b := range t.nonHeaderBlocks() {
-		if err := b.write(buf); err != nil {
-			return err
+	for _, b := range blocks {
+		start := buf.Len()
+		if err := b.write(buf, config); err != nil {
+			return nil, err
 		}
+		mapBlocks(b, start)
 	}
 
 	// Write return and function closing brace.
 	buf.WriteString("return nil\n")
 	buf.WriteString("}\n\n")
 
+	t.writeStaticText(buf, texts)
+
+	if config.Views || config.Registry {
+		t.writeView(buf)
+	}
+	if config.Registry {
+		t.writeRegistration(buf)
+	}
+
 	// Write a simple `fn() string` function
 	/*
 		fn := t.TemplateFuncName() + "String"
@@ -122,7 +272,7 @@ func (t *Template) Write(w io.Writer) error {
 
 	// Write code to external writer.
 	_, err := buf.WriteTo(w)
-	return err
+	return m, err
 }
 
 func (t *Template) String() string {
@@ -131,19 +281,77 @@ func (t *Template) String() string {
 	return buf.String()
 }
 
-func (t *Template) writeParameters(buf *bytes.Buffer, params []*ParameterBlock) {
+// writeParameters writes the parameter list and returns the offsets the
+// parameters were written at.
+func (t *Template) writeParameters(buf *bytes.Buffer, params []*ParameterBlock, config *Config) []int {
+	starts := make([]int, len(params))
 	maxIndex := len(params) - 1
 	for i, param := range params {
-		param.write(buf)
+		starts[i] = buf.Len()
+		param.write(buf, config)
 
 		if i < maxIndex {
 			buf.WriteString(", ")
 		}
 	}
+	return starts
+}
+
+// Writes the View func, which binds the template parameters to an egon.View.
+func (t *Template) writeView(buf *bytes.Buffer) {
+	params := t.parameterBlocks()
+	names := make([]string, 0, len(params)+1)
+	names = append(names, "w")
+
+	fmt.Fprintf(buf, "func %s(", t.ViewFuncName())
+	for i, param := range params {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		fmt.Fprintf(buf, "%s %s", param.ParamName, param.ParamType)
+		names = append(names, param.ParamName)
+	}
+	buf.WriteString(") *egon.View {\n")
+	buf.WriteString("return &egon.View{\n")
+	if name, err := t.PackageName(); err == nil {
+		fmt.Fprintf(buf, "PackageName: %q,\n", name)
+	}
+	fmt.Fprintf(buf, "Name: %q,\n", t.Name())
+	fmt.Fprintf(buf, "TemplatePath: %q,\n", filepath.ToSlash(t.Path))
+	fmt.Fprintf(buf, "ContentType: %q,\n", t.ContentType())
+	buf.WriteString("RenderFunc: func(w io.Writer) error {\n")
+	fmt.Fprintf(buf, "return %s(%s)\n", t.TemplateFuncName(), strings.Join(names, ", "))
+	buf.WriteString("},\n")
+	buf.WriteString("}\n")
+	buf.WriteString("}\n\n")
+}
+
+// Writes an init func registering the View func under the template's
+// registry name, with a factory that checks the argument types.
+func (t *Template) writeRegistration(buf *bytes.Buffer) {
+	params := t.parameterBlocks()
+	name := t.RegistryName()
+	args := make([]string, len(params))
+
+	buf.WriteString("func init() {\n")
+	fmt.Fprintf(buf, "egon.Register(%q, func(args ...interface{}) (*egon.View, error) {\n", name)
+	fmt.Fprintf(buf, "if len(args) != %d {\n", len(params))
+	fmt.Fprintf(buf, "return nil, &egon.ArgumentError{Name: %q, Want: %d, Got: len(args)}\n", name, len(params))
+	buf.WriteString("}\n")
+	for i, param := range params {
+		args[i] = fmt.Sprintf("p%d", i)
+		fmt.Fprintf(buf, "p%d, ok := args[%d].(%s)\n", i, i, param.ParamType)
+		buf.WriteString("if !ok {\n")
+		fmt.Fprintf(buf, "return nil, &egon.ArgumentError{Name: %q, Param: %q, Type: %q}\n", name, param.ParamName, param.ParamType)
+		buf.WriteString("}\n")
+	}
+	fmt.Fprintf(buf, "return %s(%s), nil\n", t.ViewFuncName(), strings.Join(args, ", "))
+	buf.WriteString("})\n")
+	buf.WriteString("}\n")
 }
 
 // Writes the package name and consolidated header blocks.
-func (t *Template) writeHeader(w io.Writer) error {
+func (t *Template) writeHeader(w io.Writer, config *Config, blocks []Block) error {
 	name, err := t.PackageName()
 	if err != nil {
 		return err
@@ -153,7 +361,10 @@ func (t *Template) writeHeader(w io.Writer) error {
 	var buf bytes.Buffer
 	fmt.Fprintf(&buf, "package %s\n", name)
 	for _, b := range t.headerBlocks() {
-		b.write(&buf)
+		b.write(&buf, config)
+	}
+	for _, spec := range blockImports(blocks) {
+		fmt.Fprintf(&buf, "import %s\n", spec)
 	}
 
 	// Parse header into Go AST.
@@ -163,23 +374,30 @@ func (t *Template) writeHeader(w io.Writer) error {
 		return fmt.Errorf("writeHeader: %s", err)
 	}
 
-	// Reset buffer.
+	// Reset buffer and write the package clause back.
 	buf.Reset()
+	fmt.Fprintf(&buf, "package %s\n\n", name)
 
 	// Write deduped imports.
-	var decls = map[string]bool{`:"fmt"`: true, `:"io"`: true}
-	fmt.Fprint(&buf, "import (\n")
-	if t.hasFmtPrintBlock() {
-		fmt.Fprintln(&buf, `"fmt"`)
+	decls := map[string]bool{}
+	imports := []string{`"io"`}
+	if hasFmtPrintBlock(blocks) {
+		imports = append(imports, `"fmt"`)
 	}
-	if t.hasItoaPrintBlock() {
-		fmt.Fprintln(&buf, `"strconv"`)
+	if hasStrconvPrintBlock(blocks) {
+		imports = append(imports, `"strconv"`)
 	}
-	if t.hasEscapedPrintBlock() {
-		fmt.Fprintln(&buf, `"html"`)
-		decls["html"] = true
+	if hasPrintBlock(blocks) || firstContextBlock(blocks) != nil || config.Views || config.Registry {
+		imports = append(imports, `"github.com/titpetric/egon"`)
+	}
+	if hasLocalePrintBlock(blocks) {
+		imports = append(imports, `"github.com/titpetric/egon/locale"`)
+	}
+	fmt.Fprint(&buf, "import (\n")
+	for _, path := range imports {
+		fmt.Fprintln(&buf, path)
+		decls[":"+path] = true
 	}
-	fmt.Fprintln(&buf, `"io"`)
 
 	for _, d := range f.Decls {
 		d, ok := d.(*ast.GenDecl)
@@ -227,6 +445,24 @@ func (t *Template) parameterBlocks() []*ParameterBlock {
 	return blocks
 }
 
+// contextParam returns the expression of the render context of the
+// template, from its first context.Context parameter, or else from its first
+// *http.Request parameter. It returns "" if there is neither.
+func (t *Template) contextParam() string {
+	params := t.parameterBlocks()
+	for _, param := range params {
+		if strings.TrimSpace(param.ParamType) == "context.Context" {
+			return param.ParamName
+		}
+	}
+	for _, param := range params {
+		if strings.TrimSpace(param.ParamType) == "*http.Request" {
+			return param.ParamName + ".Context()"
+		}
+	}
+	return ""
+}
+
 func (t *Template) headerBlocks() []*HeaderBlock {
 	var blocks []*HeaderBlock
 	for _, b := range t.Blocks {
@@ -249,44 +485,107 @@ func (t *Template) nonHeaderBlocks() []Block {
 	return blocks
 }
 
-func (t *Template) hasEscapedPrintBlock() bool {
-	for _, b := range t.Blocks {
+func hasPrintBlock(blocks []Block) bool {
+	for _, b := range blocks {
 		if _, ok := b.(*PrintBlock); ok {
-
 			return true
 		}
 	}
 	return false
 }
 
-func (t *Template) hasItoaPrintBlock() bool {
-	for _, b := range t.Blocks {
-		if pBlock, ok := b.(*PrintBlock); ok {
-			if pBlock.Type == 'd' {
-				return true
+// firstContextBlock returns the first block that uses the render context:
+// a translation block, or a print block formatting with the locale.
+func firstContextBlock(blocks []Block) Block {
+	for _, b := range blocks {
+		switch b := b.(type) {
+		case *TranslateBlock:
+			return b
+		case *PrintBlock:
+			if b.usesLocale() {
+				return b
 			}
 		}
 	}
+	return nil
+}
+
+func hasLocalePrintBlock(blocks []Block) bool {
+	for _, b := range blocks {
+		if b, ok := b.(*PrintBlock); ok && b.usesLocale() {
+			return true
+		}
+	}
 	return false
 }
 
-func (t *Template) hasFmtPrintBlock() bool {
-	for _, b := range t.Blocks {
-		if pBlock, ok := b.(*PrintBlock); ok {
-			if pBlock.Type != 'd' && pBlock.Type != 's' {
-				return true
-			}
+// blockImports returns the imports of the filters called by blocks, and of
+// the types of the zero values passed to components.
+func blockImports(blocks []Block) []string {
+	var imports []string
+	for _, b := range blocks {
+		switch b := b.(type) {
+		case *PrintBlock:
+			imports = append(imports, b.imports...)
+		case *RawPrintBlock:
+			imports = append(imports, b.imports...)
+		case *ComponentBlock:
+			imports = append(imports, b.imports()...)
+		}
+	}
+	return imports
+}
+
+func hasStrconvPrintBlock(blocks []Block) bool {
+	for _, b := range blocks {
+		if b, ok := b.(*PrintBlock); ok && b.usesStrconv() {
+			return true
+		}
+	}
+	return false
+}
+
+func hasScratchPrintBlock(blocks []Block) bool {
+	for _, b := range blocks {
+		if b, ok := b.(*PrintBlock); ok && b.usesScratch() {
+			return true
+		}
+	}
+	return false
+}
+
+func hasFmtPrintBlock(blocks []Block) bool {
+	for _, b := range blocks {
+		if b, ok := b.(*PrintBlock); ok && b.usesFmt() {
+			return true
 		}
 	}
 	return false
 }
 
-// normalize joins together adjacent text blocks.
+// normalize applies trim markers and joins together adjacent text blocks.
 func (t *Template) normalize() {
+	for i, b := range t.Blocks {
+		left, right := trimMarkers(b)
+		if left && i > 0 {
+			if text, ok := t.Blocks[i-1].(*TextBlock); ok && !text.Raw {
+				text.Content = strings.TrimRight(text.Content, " \t")
+			}
+		}
+		if right && i+1 < len(t.Blocks) {
+			if text, ok := t.Blocks[i+1].(*TextBlock); ok && !text.Raw {
+				text.Content = trimNewline(text.Content)
+			}
+		}
+	}
+
 	var a []Block
 	for _, b := range t.Blocks {
 		if isTextBlock(b) && len(a) > 0 && isTextBlock(a[len(a)-1]) {
-			a[len(a)-1].(*TextBlock).Content += b.(*TextBlock).Content
+			last := a[len(a)-1].(*TextBlock)
+			last.Content += b.(*TextBlock).Content
+			last.Source += b.(*TextBlock).Source
+			last.Raw = last.Raw && b.(*TextBlock).Raw
 		} else {
 			a = append(a, b)
 		}
@@ -294,4 +593,12 @@ func (t *Template) normalize() {
 	t.Blocks = a
 }
 
+// trimNewline removes a single leading newline from s.
+func trimNewline(s string) string {
+	if strings.HasPrefix(s, "\r\n") {
+		return s[2:]
+	}
+	return strings.TrimPrefix(s, "\n")
+}
+
 var _ fmt.Stringer = &Template{}
@@ -1,9 +1,15 @@
 package egon_test
 
 import (
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
 	"github.com/stretchr/testify/assert"
 	. "github.com/titpetric/egon"
-	"testing"
 )
 
 // Ensure that a template can be written to a writer.
@@ -59,3 +65,133 @@ func TestTemplate_SourceFile(t *testing.T) {
 
 	assert.Equal(t, "foo.egon.go", name)
 }
+
+// Ensure that writing a template leaves its blocks untouched, so the same
+// template can be written concurrently.
+func TestTemplate_WriteDoesNotMutate(t *testing.T) {
+	tmpl := &Template{
+		Path:   "/tmp/foo.egon",
+		Config: &Config{Minify: true},
+		Blocks: []Block{
+			&TextBlock{Content: "<p>\n    hello\n</p>"},
+		},
+	}
+	first := tmpl.String()
+	assert.Equal(t, "<p>\n    hello\n</p>", tmpl.Blocks[0].(*TextBlock).Content)
+	assert.Equal(t, first, tmpl.String())
+}
+
+// Ensure that the generated source starts with a package clause.
+func TestTemplate_WritePackageClause(t *testing.T) {
+	tmpl := &Template{Path: "/tmp/views/foo.egon"}
+	assert.True(t, strings.HasPrefix(tmpl.String(), "package views\n"))
+}
+
+// Ensure that the registry name is derived from the path relative to Root.
+func TestTemplate_RegistryName(t *testing.T) {
+	tmpl := &Template{Path: "views/users/list.html.egon", Root: "views"}
+	assert.Equal(t, "users/list", tmpl.RegistryName())
+
+	tmpl = &Template{Path: "views/users/list.egon"}
+	assert.Equal(t, "list", tmpl.RegistryName())
+}
+
+// Ensure that a registered template generates a View func and an init func.
+func TestTemplate_WriteRegistry(t *testing.T) {
+	tmpl := &Template{
+		Path:   "/tmp/views/users/list.egon",
+		Root:   "/tmp/views",
+		Config: &Config{Registry: true},
+		Blocks: []Block{
+			&ParameterBlock{ParamName: "names", ParamType: "[]string"},
+			&TextBlock{Content: "<ul>"},
+		},
+	}
+	src := tmpl.String()
+	assert.Contains(t, src, "func ListView(names []string) *egon.View {")
+	assert.Contains(t, src, `egon.Register("users/list", func(args ...interface{}) (*egon.View, error) {`)
+
+	_, err := parser.ParseFile(token.NewFileSet(), "list.egon.go", src, 0)
+	assert.NoError(t, err)
+}
+
+// Ensure that the content type follows the inner file extension.
+func TestTemplate_ContentType(t *testing.T) {
+	assert.Equal(t, "text/html; charset=utf-8", (&Template{Path: "index.egon"}).ContentType())
+	assert.Equal(t, "text/xml; charset=utf-8", (&Template{Path: "feed.xml.egon"}).ContentType())
+	assert.Equal(t, "application/json", (&Template{Path: "data.json.egon"}).ContentType())
+	assert.Equal(t, "text/plain; charset=utf-8", (&Template{Path: "mail.TXT.egon"}).ContentType())
+	assert.Equal(t, DefaultContentType, (&Template{Path: "page.unknown.egon"}).ContentType())
+}
+
+// Ensure that comments, empty code blocks and constant prints are folded
+// into a single piece of static text.
+func TestTemplate_WriteFoldsStaticText(t *testing.T) {
+	src := `<p><%# note #%>a<% %><%== "b" + "c" %><%= "<d>" %></p><%= x %><p>`
+	tmpl, err := Parse(strings.NewReader(src), "/tmp/views/fold.egon")
+	assert.NoError(t, err)
+	tmpl.Blocks = append([]Block{&ParameterBlock{ParamName: "x", ParamType: "string"}}, tmpl.Blocks...)
+
+	out := tmpl.String()
+	assert.Contains(t, out, `egonFoldText0 = []byte("<p>abc&lt;d&gt;</p>")`)
+	assert.Contains(t, out, "w.Write(egonFoldText0)\n")
+	assert.Contains(t, out, `egonFoldText1 = []byte("<p>")`)
+	assert.Equal(t, 1, strings.Count(out, "w.Write("+"egonFoldText0)"))
+
+	_, err = parser.ParseFile(token.NewFileSet(), "fold.egon.go", out, 0)
+	assert.NoError(t, err)
+}
+
+// Ensure that print blocks get a format code from the type of their
+// expression when type inference is enabled.
+func TestTemplate_WriteInfersTypes(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "views")
+	assert.NoError(t, os.Mkdir(dir, 0755))
+	types := `package views
+
+import (
+	"fmt"
+	"strconv"
+)
+
+type ID int
+
+type Status int
+
+func (s Status) String() string { return strconv.Itoa(int(s)) }
+
+type Name string
+
+type Code int
+
+func (c Code) String() string { return "code" }
+
+func (c Code) Error() string { return "error" }
+
+type Money int
+
+func (m Money) String() string { return "money" }
+
+func (m Money) Format(f fmt.State, verb rune) { fmt.Fprint(f, "formatted") }
+`
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "types.go"), []byte(types), 0644))
+
+	src := `<%! id ID %><%! n uint %><%! f float64 %><%! ok bool %><%! s string %><%! st Status %><%! name Name %><%! p *ID %><%! code Code %><%! m Money %>` +
+		`<%= id %><%= n %><%= f %><%= ok %><%= s %><%= st %><%= name %><%= p %><%= undefined %><%=x id %><%= code %><%= m %>`
+	tmpl, err := ParseConfig(strings.NewReader(src), filepath.Join(dir, "infer.egon"), &Config{Typesafe: true, StringOptimisations: true})
+	assert.NoError(t, err)
+
+	out := tmpl.String()
+	assert.Contains(t, out, "egon.AppendInt(egonScratch.B[:0],  id )")
+	assert.Contains(t, out, "egon.AppendUint(egonScratch.B[:0],  n )")
+	assert.Contains(t, out, "egon.AppendFloat(egonScratch.B[:0],  f , 'g', -1)")
+	assert.Contains(t, out, "strconv.AppendBool(egonScratch.B[:0],  ok )")
+	assert.Contains(t, out, "egon.EscapeString(w,  s )")
+	assert.Contains(t, out, "egon.EscapeString(w, ( st ).String())")
+	assert.Contains(t, out, "egon.Print(w,  name )")
+	assert.Contains(t, out, "egon.Print(w,  p )")
+	assert.Contains(t, out, "egon.Print(w,  undefined )")
+	assert.Contains(t, out, `egon.EscapeString(w, fmt.Sprintf("%x", id ))`)
+	assert.Contains(t, out, "egon.Print(w,  code )")
+	assert.Contains(t, out, "egon.Print(w,  m )")
+}
@@ -0,0 +1,176 @@
+package egon
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/titpetric/egon/locale"
+)
+
+// Translator translates the messages of translation blocks. Messages have
+// {name} placeholders, which are filled in after translating, so a
+// translation may move them around.
+//
+// A translation is a string, which is HTML escaped when it is written, or
+// HTML, which is written as it is, for translations that contain markup.
+type Translator interface {
+	Translate(msg string) interface{}
+}
+
+// PluralTranslator is a Translator that also translates messages with a
+// plural form. form is the plural category of the count in the locale of
+// the render context.
+type PluralTranslator interface {
+	Translator
+	TranslatePlural(msg, plural string, form locale.Form) interface{}
+}
+
+// TranslatorFunc adapts a func to the Translator interface. Its
+// translations are escaped.
+type TranslatorFunc func(msg string) string
+
+// Translate calls f(msg).
+func (f TranslatorFunc) Translate(msg string) interface{} {
+	return f(msg)
+}
+
+type translatorKey struct{}
+
+// WithTranslator returns a copy of ctx carrying t, which the translation
+// blocks of templates rendered with the context use.
+func WithTranslator(ctx context.Context, t Translator) context.Context {
+	return context.WithValue(ctx, translatorKey{}, t)
+}
+
+// TranslatorFrom returns the Translator carried by ctx, or nil if there is
+// none.
+func TranslatorFrom(ctx context.Context) Translator {
+	if ctx == nil {
+		return nil
+	}
+	t, _ := ctx.Value(translatorKey{}).(Translator)
+	return t
+}
+
+// Translate writes msg as a translation block does: it is translated with
+// the Translator of ctx, if there is one, and its placeholders are replaced
+// by the values of args, given as name, value pairs, and written with Print.
+// The message itself is HTML escaped, unless it is translated to HTML.
+// Placeholders without a value are written as they are.
+func Translate(w io.Writer, ctx context.Context, msg string, args ...interface{}) error {
+	var translated interface{} = msg
+	if t := TranslatorFrom(ctx); t != nil {
+		translated = t.Translate(msg)
+	}
+	return writeMessage(w, translated, args)
+}
+
+// TranslatePlural writes msg or its plural form as a translation block with
+// a plural message does. The first value of args is the count. The form is
+// translated by the Translator of ctx if it is a PluralTranslator, and is
+// otherwise picked with the English rules of the untranslated message.
+func TranslatePlural(w io.Writer, ctx context.Context, msg, plural string, args ...interface{}) error {
+	var n int64
+	if len(args) >= 2 {
+		n = pluralCount(args[1])
+	}
+	var translated interface{} = msg
+	if t, ok := TranslatorFrom(ctx).(PluralTranslator); ok {
+		translated = t.TranslatePlural(msg, plural, locale.FromContext(ctx).Plural(n))
+	} else if locale.Default.Plural(n) != locale.One {
+		translated = plural
+	}
+	return writeMessage(w, translated, args)
+}
+
+// pluralCount returns the count v as an integer. Counts with a fraction
+// are truncated.
+func pluralCount(v interface{}) int64 {
+	switch v := v.(type) {
+	case int:
+		return int64(v)
+	case int8:
+		return int64(v)
+	case int16:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case int64:
+		return v
+	case uint:
+		return int64(v)
+	case uint8:
+		return int64(v)
+	case uint16:
+		return int64(v)
+	case uint32:
+		return int64(v)
+	case uint64:
+		return int64(v)
+	case float32:
+		return int64(math.Trunc(float64(v)))
+	case float64:
+		return int64(math.Trunc(v))
+	}
+	return 0
+}
+
+// writeMessage writes the translation translated with its placeholders
+// replaced by the values of args. The text around them is escaped, unless
+// translated is HTML.
+func writeMessage(w io.Writer, translated interface{}, args []interface{}) error {
+	var msg string
+	write := EscapeString
+	switch v := translated.(type) {
+	case HTML:
+		msg, write = string(v), writeString
+	case string:
+		msg = v
+	default:
+		msg = fmt.Sprint(v)
+	}
+
+	for {
+		start := strings.IndexByte(msg, '{')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(msg[start:], '}')
+		if end < 0 {
+			break
+		}
+		end += start
+
+		if err := write(w, msg[:start]); err != nil {
+			return err
+		}
+		if v, ok := translateArg(args, msg[start+1:end]); ok {
+			if err := Print(w, v); err != nil {
+				return err
+			}
+		} else if err := write(w, msg[start:end+1]); err != nil {
+			return err
+		}
+		msg = msg[end+1:]
+	}
+	return write(w, msg)
+}
+
+// writeString writes s to w as it is.
+func writeString(w io.Writer, s string) error {
+	_, err := io.WriteString(w, s)
+	return err
+}
+
+// translateArg returns the value of the placeholder name in args.
+func translateArg(args []interface{}, name string) (interface{}, bool) {
+	for i := 0; i+1 < len(args); i += 2 {
+		if args[i] == name {
+			return args[i+1], true
+		}
+	}
+	return nil, false
+}
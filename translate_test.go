@@ -0,0 +1,183 @@
+package egon_test
+
+import (
+	"bytes"
+	"context"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	. "github.com/titpetric/egon"
+	"github.com/titpetric/egon/locale"
+)
+
+// Ensure that a translation block can be scanned, with expressions that
+// contain spaces and brackets.
+func TestScannerTranslateBlock(t *testing.T) {
+	s := NewScanner(bytes.NewBufferString(`<%t "Hello, {name}, {n} new" name=u.First + " " + u.Last n=len(f(a, b=c)) %>`), "tmpl.egon")
+	b, err := s.Scan()
+	assert.NoError(t, err)
+	if b, ok := b.(*TranslateBlock); assert.True(t, ok) {
+		assert.Equal(t, "Hello, {name}, {n} new", b.Message)
+		if assert.Len(t, b.Args, 2) {
+			assert.Equal(t, "name", b.Args[0].Name)
+			assert.Equal(t, `u.First + " " + u.Last`, b.Args[0].Expr)
+			assert.Equal(t, "n", b.Args[1].Name)
+			assert.Equal(t, "len(f(a, b=c))", b.Args[1].Expr)
+		}
+	}
+}
+
+// Ensure that a translation block with a plural message can be scanned.
+func TestScannerTranslateBlockPlural(t *testing.T) {
+	s := NewScanner(bytes.NewBufferString("<%t \"{n} item\" `{n} items` n=len(items) %>"), "tmpl.egon")
+	b, err := s.Scan()
+	assert.NoError(t, err)
+	if b, ok := b.(*TranslateBlock); assert.True(t, ok) {
+		assert.Equal(t, "{n} item", b.Message)
+		assert.Equal(t, "{n} items", b.Plural)
+		assert.Len(t, b.Args, 1)
+	}
+}
+
+// Ensure that code blocks starting with "t" aren't read as translations.
+func TestScannerTranslateBlockCode(t *testing.T) {
+	for _, src := range []string{`<%t := "x" %>`, `<%t.Run() %>`, `<%total++%>`} {
+		b, err := NewScanner(bytes.NewBufferString(src), "tmpl.egon").Scan()
+		assert.NoError(t, err)
+		if b, ok := b.(*CodeBlock); assert.True(t, ok, src) {
+			assert.Equal(t, src[2:len(src)-2], b.Content)
+			assert.Equal(t, src, b.Source)
+		}
+	}
+}
+
+// Ensure that badly formed translation blocks return an error.
+func TestScannerTranslateBlockFormat(t *testing.T) {
+	for _, src := range []string{`<%t "a" x %>`, `<%t "a" x= %>`, `<%t "a" x=1 x=2 %>`, "<%t `a` + b %>", `<%t "a" "b" %>`} {
+		_, err := NewScanner(bytes.NewBufferString(src), "tmpl.egon").Scan()
+		assert.Equal(t, ErrTranslationFormat, err, src)
+	}
+}
+
+// Ensure that translation blocks are written as calls to egon.Translate
+// with the render context of the template.
+func TestTemplate_WriteTranslate(t *testing.T) {
+	src := "<%! u *User %><%! ctx context.Context %><p><%t \"Hello, {name}\" name=u.Name %></p>"
+	tmpl, err := Parse(strings.NewReader(src), "/tmp/views/hello.egon")
+	assert.NoError(t, err)
+
+	out := tmpl.String()
+	assert.Contains(t, out, "egonCtx := ctx\n")
+	assert.Contains(t, out, `egon.Translate(w, egonCtx, "Hello, {name}", "name", u.Name)`)
+	assert.Contains(t, out, `"github.com/titpetric/egon"`)
+	_, err = parser.ParseFile(token.NewFileSet(), "hello.egon.go", out, 0)
+	assert.NoError(t, err)
+
+	tmpl, err = Parse(strings.NewReader(`<%! r *http.Request %><%t "Hi" %>`), "/tmp/views/hi.egon")
+	assert.NoError(t, err)
+	assert.Contains(t, tmpl.String(), "egonCtx := r.Context()\n")
+
+	tmpl, err = Parse(strings.NewReader(`<%! ctx context.Context %><%t "{n} item" "{n} items" n=len(items) %>`), "/tmp/views/items.egon")
+	assert.NoError(t, err)
+	assert.Contains(t, tmpl.String(), `egon.TranslatePlural(w, egonCtx, "{n} item", "{n} items", "n", len(items))`)
+}
+
+// Ensure that print blocks with locale format codes format with the locale
+// of the render context.
+func TestTemplate_WriteLocale(t *testing.T) {
+	src := "<%! ctx context.Context %><%=n.2 price %><%=n count %><%=M total %><%=L date %>"
+	tmpl, err := ParseConfig(strings.NewReader(src), "/tmp/views/cart.egon", &Config{StringOptimisations: true})
+	assert.NoError(t, err)
+
+	out := tmpl.String()
+	assert.Contains(t, out, "egonLocale := locale.FromContext(egonCtx)\n")
+	assert.Contains(t, out, `"github.com/titpetric/egon/locale"`)
+	assert.Contains(t, out, "w.Write(egon.AppendNumber(egonLocale, egonScratch.B[:0], price , 2))")
+	assert.Contains(t, out, "w.Write(egon.AppendNumber(egonLocale, egonScratch.B[:0], count , -1))")
+	assert.Contains(t, out, "egon.EscapeString(w, egonLocale.FormatMoney(total ))")
+	assert.Contains(t, out, "w.Write(egonLocale.AppendDate(egonScratch.B[:0], date ))")
+	_, err = parser.ParseFile(token.NewFileSet(), "cart.egon.go", out, 0)
+	assert.NoError(t, err)
+
+	tmpl, err = ParseConfig(strings.NewReader("<%=n x %>"), "/tmp/views/cart.egon", &Config{StringOptimisations: true})
+	assert.NoError(t, err)
+	assert.Error(t, tmpl.Write(&bytes.Buffer{}))
+}
+
+// Ensure that templates with translation blocks and no render context
+// don't generate.
+func TestTemplate_WriteTranslateNoContext(t *testing.T) {
+	tmpl, err := Parse(strings.NewReader("<p>\n<%t \"Hi\" %></p>"), "/tmp/views/hi.egon")
+	assert.NoError(t, err)
+
+	err = tmpl.Write(&bytes.Buffer{})
+	if e, ok := err.(*scanner.Error); assert.True(t, ok) {
+		assert.Equal(t, 2, e.Pos.Line)
+		assert.Equal(t, ErrRenderContext.Error(), e.Msg)
+	}
+}
+
+// htmlTranslator translates messages to HTML.
+type htmlTranslator struct{}
+
+func (htmlTranslator) Translate(msg string) interface{} {
+	return HTML("<b>{name}</b>")
+}
+
+// Ensure that messages are translated with the Translator of the context,
+// and escaped with their placeholders filled in with escaped values.
+func TestTranslate(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, Translate(&buf, context.Background(), "Hello, <b>{name}</b> {missing}", "name", "<Bob>"))
+	assert.Equal(t, "Hello, &lt;b&gt;&lt;Bob&gt;&lt;/b&gt; {missing}", buf.String())
+
+	buf.Reset()
+	evil := TranslatorFunc(func(string) string { return "<script>{name}</script>" })
+	assert.NoError(t, Translate(&buf, WithTranslator(context.Background(), evil), "Hello, {name}", "name", "Bob"))
+	assert.Equal(t, "&lt;script&gt;Bob&lt;/script&gt;", buf.String())
+
+	buf.Reset()
+	assert.NoError(t, Translate(&buf, WithTranslator(context.Background(), htmlTranslator{}), "Hello, {name}", "name", "<Bob>"))
+	assert.Equal(t, "<b>&lt;Bob&gt;</b>", buf.String())
+
+	de := TranslatorFunc(func(msg string) string {
+		if msg == "{n} new messages for {name}" {
+			return "{name} hat {n} neue Nachrichten"
+		}
+		return msg
+	})
+	ctx := WithTranslator(context.Background(), de)
+	buf.Reset()
+	assert.NoError(t, Translate(&buf, ctx, "{n} new messages for {name}", "name", "Bob", "n", 3))
+	assert.Equal(t, "Bob hat 3 neue Nachrichten", buf.String())
+	assert.Nil(t, TranslatorFrom(context.Background()))
+}
+
+// pluralTranslator translates plural messages to Russian.
+type pluralTranslator struct{ TranslatorFunc }
+
+func (pluralTranslator) TranslatePlural(msg, plural string, form locale.Form) interface{} {
+	return map[locale.Form]string{locale.One: "{n} файл", locale.Few: "{n} файла", locale.Many: "{n} файлов"}[form]
+}
+
+// Ensure that plural messages pick their form with the plural rules of the
+// locale of the context.
+func TestTranslatePlural(t *testing.T) {
+	render := func(ctx context.Context, n interface{}) string {
+		var buf bytes.Buffer
+		assert.NoError(t, TranslatePlural(&buf, ctx, "{n} file", "{n} files", "n", n))
+		return buf.String()
+	}
+	assert.Equal(t, "1 file", render(context.Background(), 1))
+	assert.Equal(t, "2 files", render(context.Background(), uint8(2)))
+	assert.Equal(t, "0 files", render(context.Background(), 0))
+
+	ctx := WithTranslator(locale.NewContext(context.Background(), locale.Lookup("ru")), pluralTranslator{})
+	assert.Equal(t, "21 файл", render(ctx, 21))
+	assert.Equal(t, "3 файла", render(ctx, int64(3)))
+	assert.Equal(t, "11 файлов", render(ctx, 11))
+}
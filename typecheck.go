@@ -0,0 +1,243 @@
+package egon
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// probeName returns the name of the variable that holds the value of the
+// i-th print block while type checking.
+func probeName(i int) string {
+	return fmt.Sprintf("egonProbe%d", i)
+}
+
+// inferTypes returns blocks with a format code set on the print blocks
+// that don't have one, based on the type of their expression. The template
+// func is type checked together with the other files of its package; print
+// blocks whose type can't be determined are left as they are.
+func (t *Template) inferTypes(blocks []Block) []Block {
+	// Replace the print blocks with assignments that the type of the
+	// expression can be read back from.
+	probe := make([]Block, len(blocks))
+	untyped := map[int]*PrintBlock{}
+	for i, b := range blocks {
+		probe[i] = b
+		if b, ok := b.(*PrintBlock); ok && b.Type == 0 {
+			untyped[i] = b
+			probe[i] = &CodeBlock{Content: fmt.Sprintf("%s := (%s)\n_ = %s", probeName(i), printExpr(b.Content), probeName(i))}
+		}
+	}
+	if len(untyped) == 0 {
+		return blocks
+	}
+
+	var src bytes.Buffer
+	if _, err := t.writeBlocks(&src, &Config{}, probe); err != nil {
+		return blocks
+	}
+
+	defs, ok := t.typeCheck(src.Bytes())
+	if !ok {
+		return blocks
+	}
+
+	out := make([]Block, len(blocks))
+	copy(out, blocks)
+	for i, b := range untyped {
+		typ, ok := defs[probeName(i)]
+		if !ok {
+			continue
+		}
+		if code := formatCode(typ); code != 0 {
+			typed := *b
+			typed.Type = code
+			out[i] = &typed
+		}
+	}
+	return out
+}
+
+// typeCheck type checks src as part of the template's package and returns
+// the types of the variables declared in it by name.
+func (t *Template) typeCheck(src []byte) (map[string]types.Type, bool) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, t.SourceFile(), src, 0)
+	if err != nil {
+		return nil, false
+	}
+	files := append(packageFiles(fset, filepath.Dir(t.SourceFile()), t.SourceFile(), f.Name.Name), f)
+
+	info := &types.Info{Defs: map[*ast.Ident]types.Object{}}
+	conf := types.Config{
+		Importer: t.Config.orDefault().importer(),
+		Error:    func(error) {},
+	}
+	conf.Check(f.Name.Name, fset, files, info)
+
+	defs := map[string]types.Type{}
+	for ident, obj := range info.Defs {
+		if obj == nil || !strings.HasPrefix(ident.Name, "egonProbe") {
+			continue
+		}
+		if typ := obj.Type(); typ != nil && typ != types.Typ[types.Invalid] {
+			defs[ident.Name] = typ
+		}
+	}
+	return defs, true
+}
+
+// packageFiles parses the Go files of package name in dir, except for
+// test files and the file at exclude.
+func packageFiles(fset *token.FileSet, dir, exclude, name string) []*ast.File {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	var files []*ast.File
+	for _, entry := range entries {
+		filename := entry.Name()
+		path := filepath.Join(dir, filename)
+		if entry.IsDir() || filepath.Ext(filename) != ".go" || strings.HasSuffix(filename, "_test.go") || path == exclude {
+			continue
+		}
+		if ok, err := build.Default.MatchFile(dir, filename); err != nil || !ok {
+			continue
+		}
+		f, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil || f.Name.Name != name {
+			continue
+		}
+		files = append(files, f)
+	}
+	return files
+}
+
+// formatCode returns the print block format code that writes a value of
+// typ the same way fmt.Sprint does, or 0 if there is none.
+func formatCode(typ types.Type) byte {
+	if _, ok := typ.Underlying().(*types.Interface); ok {
+		return 0
+	}
+	if _, ok := typ.(*types.Pointer); ok {
+		return 0
+	}
+	if isSafeType(typ) {
+		return 'H'
+	}
+	// fmt prefers Format and Error to String, so values with those methods
+	// are left to egon.Print.
+	if isFormatter(typ) || types.Implements(typ, errorType) {
+		return 0
+	}
+	if isStringer(typ) {
+		return 'S'
+	}
+
+	basic, ok := typ.Underlying().(*types.Basic)
+	if !ok {
+		return 0
+	}
+	info := basic.Info()
+	switch {
+	case info&types.IsInteger != 0 && info&types.IsUnsigned != 0:
+		return 'u'
+	case info&types.IsInteger != 0:
+		return 'd'
+	case basic.Kind() == types.Float64 || basic.Kind() == types.UntypedFloat:
+		return 'g'
+	case info&types.IsBoolean != 0:
+		return 't'
+	case info&types.IsString != 0 && typ == basic:
+		return 's'
+	}
+	return 0
+}
+
+// isSafeType returns true if typ is one of the egon types holding content
+// that is written without escaping.
+func isSafeType(typ types.Type) bool {
+	named, ok := typ.(*types.Named)
+	if !ok || named.Obj().Pkg() == nil || named.Obj().Pkg().Path() != "github.com/titpetric/egon" {
+		return false
+	}
+	switch named.Obj().Name() {
+	case "HTML", "URL", "JS", "CSS":
+		return true
+	}
+	return false
+}
+
+var errorType = types.Universe.Lookup("error").Type().Underlying().(*types.Interface)
+
+// isFormatter returns true if values of typ implement fmt.Formatter, with a
+// Format(fmt.State, rune) method.
+func isFormatter(typ types.Type) bool {
+	obj, _, _ := types.LookupFieldOrMethod(typ, false, nil, "Format")
+	fn, ok := obj.(*types.Func)
+	if !ok {
+		return false
+	}
+	sig := fn.Type().(*types.Signature)
+	if sig.Params().Len() != 2 || sig.Results().Len() != 0 {
+		return false
+	}
+	state, ok := sig.Params().At(0).Type().(*types.Named)
+	if !ok || state.Obj().Pkg() == nil || state.Obj().Pkg().Path() != "fmt" || state.Obj().Name() != "State" {
+		return false
+	}
+	verb, ok := sig.Params().At(1).Type().(*types.Basic)
+	return ok && verb.Kind() == types.Int32
+}
+
+// isStringer returns true if values of typ have a String() string method.
+func isStringer(typ types.Type) bool {
+	obj, _, _ := types.LookupFieldOrMethod(typ, false, nil, "String")
+	fn, ok := obj.(*types.Func)
+	if !ok {
+		return false
+	}
+	sig := fn.Type().(*types.Signature)
+	if sig.Params().Len() != 0 || sig.Results().Len() != 1 {
+		return false
+	}
+	result, ok := sig.Results().At(0).Type().(*types.Basic)
+	return ok && result.Kind() == types.String
+}
+
+// NewImporter returns an importer that type checks imported packages from
+// source, for Config.Importer. It caches every package it checks, so it
+// doesn't see later changes to them. It is safe for concurrent use.
+func NewImporter() types.ImporterFrom {
+	imp := importer.ForCompiler(token.NewFileSet(), "source", nil).(types.ImporterFrom)
+	return &lockedImporter{importer: imp}
+}
+
+// lockedImporter serialises access to an importer that isn't safe for
+// concurrent use.
+type lockedImporter struct {
+	mu       sync.Mutex
+	importer types.ImporterFrom
+}
+
+func (l *lockedImporter) Import(path string) (*types.Package, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.importer.Import(path)
+}
+
+func (l *lockedImporter) ImportFrom(path, dir string, mode types.ImportMode) (*types.Package, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.importer.ImportFrom(path, dir, mode)
+}
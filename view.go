@@ -7,10 +7,15 @@ import (
 // View represents a runnable form of a template that can be passed between
 // layers in an application without needing to render until the last necessary
 // moment.
+//
+// ContentType and Status are used when the view is served over HTTP; an
+// empty ContentType means DefaultContentType and a zero Status means 200.
 type View struct {
 	PackageName  string
 	Name         string
 	TemplatePath string
+	ContentType  string
+	Status       int
 	RenderFunc   func(io.Writer) error
 }
 